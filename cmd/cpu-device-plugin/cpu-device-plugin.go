@@ -8,7 +8,10 @@ import (
 	"os/signal"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -24,19 +27,30 @@ import (
 
 var (
 	resourceBaseName = "nokia.k8s.io"
+	kubeletSocket    = path.Join(pluginapi.DevicePluginPath, "kubelet.sock")
 	cdms             []*cpuDeviceManager
+	//cdmsLock guards the modifications of cdms done by the main loop against the readers running in other goroutines (e.g. metrics scrapes)
+	cdmsLock sync.RWMutex
 )
 
 type cpuDeviceManager struct {
-	pool           types.Pool
-	socketFile     string
-	grpcServer     *grpc.Server
-	sharedPoolCPUs string
-	poolType       string
-	nodeTopology   map[int]int
-	htTopology     map[int]string
+	poolName      string
+	pool          types.Pool
+	poolLock      sync.RWMutex
+	unhealthyCPUs cpuset.CPUSet
+	updateChan    chan struct{}
+	stopChan      chan struct{}
+	socketFile    string
+	grpcServer    *grpc.Server
+	poolType      string
+	nodeTopology  map[int]int
+	htTopology    map[int]string
+	cacheTopology map[int]int
 }
 
+//topologyLevel maps a CPU core ID to the ID of the topology domain (NUMA node, L3 cache, physical core) it belongs to
+type topologyLevel func(cpuID int) int
+
 //TODO: PoC if cpuset setting could be implemented in this hook? cpuset cgroup of the container should already exist at this point (kinda)
 //The DeviceIDs could be used to determine which container has them, once we have a container name parsed out from the allocation backend we could manipulate its cpuset before it is even started
 //Long shot, but if it works both cpusetter and process starter would become unnecessary
@@ -87,46 +101,95 @@ func (cdm *cpuDeviceManager) Stop() error {
 	if cdm.grpcServer == nil {
 		return nil
 	}
+	//Open ListAndWatch streams are closed first, so the gRPC server does not need to wait for them
+	close(cdm.stopChan)
 	cdm.grpcServer.Stop()
 	cdm.grpcServer = nil
 	return cdm.cleanup()
 }
 
+//ListAndWatch streams the current device list of the pool to kubelet, and re-sends it every time the pool is updated
 func (cdm *cpuDeviceManager) ListAndWatch(e *pluginapi.Empty, stream pluginapi.DevicePlugin_ListAndWatchServer) error {
-	var updateNeeded = true
 	for {
-		if updateNeeded {
-			resp := new(pluginapi.ListAndWatchResponse)
-			if cdm.poolType == "shared" {
-				nbrOfCPUs := cdm.pool.CPUset.Size()
-				for i := 0; i < nbrOfCPUs*1000; i++ {
-					cpuID := strconv.Itoa(i)
-					resp.Devices = append(resp.Devices, &pluginapi.Device{ID: cpuID, Health: pluginapi.Healthy})
-				}
-			} else {
-				for _, cpuID := range cdm.pool.CPUset.ToSlice() {
-					exclusiveCore := pluginapi.Device{ID: strconv.Itoa(cpuID), Health: pluginapi.Healthy}
-					if numaNode, exists := cdm.nodeTopology[cpuID]; exists {
-						exclusiveCore.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(numaNode)}}}
-					}
-					resp.Devices = append(resp.Devices, &exclusiveCore)
-				}
-			}
-			if err := stream.Send(resp); err != nil {
-				glog.Errorf("Error. Cannot update device states: %v\n", err)
-				return err
-			}
-			updateNeeded = false
+		resp := &pluginapi.ListAndWatchResponse{Devices: cdm.devices()}
+		if err := stream.Send(resp); err != nil {
+			glog.Errorf("Error. Cannot update device states: %v\n", err)
+			return err
+		}
+		select {
+		case <-cdm.updateChan:
+			glog.Infof("Sending updated device list of pool: %s to kubelet", cdm.poolName)
+		case <-cdm.stopChan:
+			return nil
+		case <-stream.Context().Done():
+			return nil
 		}
-		//TODO: When is update needed ?
-		time.Sleep(5 * time.Second)
 	}
-	return nil
+}
+
+func (cdm *cpuDeviceManager) devices() []*pluginapi.Device {
+	pool := cdm.getPool()
+	unhealthyCPUs := cdm.getUnhealthyCPUs()
+	devices := []*pluginapi.Device{}
+	if cdm.poolType == "shared" {
+		nbrOfCPUs := pool.CPUset.Size()
+		//Millicores are not tied to specific CPUs, so the last ones are reported unhealthy in proportion to the unhealthy CPUs of the pool
+		firstUnhealthyID := (nbrOfCPUs - pool.CPUset.Intersection(unhealthyCPUs).Size()) * 1000
+		for i := 0; i < nbrOfCPUs*1000; i++ {
+			cpuID := strconv.Itoa(i)
+			devices = append(devices, &pluginapi.Device{ID: cpuID, Health: deviceHealth(i >= firstUnhealthyID)})
+		}
+		return devices
+	}
+	for _, cpuID := range pool.CPUset.ToSlice() {
+		exclusiveCore := pluginapi.Device{ID: strconv.Itoa(cpuID), Health: deviceHealth(cdm.isExclusiveCoreUnhealthy(cpuID, pool, unhealthyCPUs))}
+		if numaNode, exists := cdm.nodeTopology[cpuID]; exists {
+			exclusiveCore.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(numaNode)}}}
+		}
+		devices = append(devices, &exclusiveCore)
+	}
+	return devices
+}
+
+func (cdm *cpuDeviceManager) getPool() types.Pool {
+	cdm.poolLock.RLock()
+	defer cdm.poolLock.RUnlock()
+	return cdm.pool
+}
+
+//updatePool replaces the pool of the plugin, and signals the open ListAndWatch stream to re-send the device list in case the pool changed
+//The health of the devices is re-evaluated right away, as the new CPUs or the new required isolation can change it
+func (cdm *cpuDeviceManager) updatePool(pool types.Pool) {
+	cdm.poolLock.Lock()
+	changed := !cdm.pool.CPUset.Equals(pool.CPUset) || cdm.pool.HTPolicy != pool.HTPolicy || !reflect.DeepEqual(cdm.pool.RequiredIsolation, pool.RequiredIsolation)
+	cdm.pool = pool
+	cdm.poolLock.Unlock()
+	if !changed {
+		return
+	}
+	glog.Infof("Pool: %s updated to CPUs: %s, required isolation: %v", cdm.poolName, pool.CPUset.String(), pool.RequiredIsolation)
+	//The health of the devices depends on both the CPUs of the pool, and the isolation it requires
+	state, err := readCPUState()
+	if err != nil {
+		glog.Errorf("CPU state could not be read, device health of updated pool: %s is re-evaluated at the next health check: %v", cdm.poolName, err)
+	} else {
+		cdm.updateHealth(cdm.unhealthyCPUsIn(state))
+	}
+	cdm.notifyUpdate()
+}
 
+func (cdm *cpuDeviceManager) notifyUpdate() {
+	select {
+	case cdm.updateChan <- struct{}{}:
+	default:
+		//An update is already pending, the stream will send the latest devices anyway
+	}
 }
 
-func (cdm *cpuDeviceManager) Allocate(ctx context.Context, rqt *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
-	resp := new(pluginapi.AllocateResponse)
+func (cdm *cpuDeviceManager) Allocate(ctx context.Context, rqt *pluginapi.AllocateRequest) (resp *pluginapi.AllocateResponse, err error) {
+	defer func(start time.Time) { observeAllocate(cdm.poolName, start, err) }(time.Now())
+	resp = new(pluginapi.AllocateResponse)
+	pool := cdm.getPool()
 	for _, container := range rqt.ContainerRequests {
 		envmap := make(map[string]string)
 		cpusAllocated, _ := cpuset.Parse("")
@@ -134,11 +197,11 @@ func (cdm *cpuDeviceManager) Allocate(ctx context.Context, rqt *pluginapi.Alloca
 			tempSet, _ := cpuset.Parse(id)
 			cpusAllocated = cpusAllocated.Union(tempSet)
 		}
-		if cdm.pool.HTPolicy == types.MultiThreadHTPolicy {
+		if pool.HTPolicy == types.MultiThreadHTPolicy {
 			cpusAllocated = topology.AddHTSiblingsToCPUSet(cpusAllocated, cdm.htTopology)
 		}
 		if cdm.poolType == "shared" {
-			envmap["SHARED_CPUS"] = cdm.sharedPoolCPUs
+			envmap["SHARED_CPUS"] = pool.CPUset.String()
 		} else {
 			envmap["EXCLUSIVE_CPUS"] = cpusAllocated.String()
 		}
@@ -155,7 +218,7 @@ func (cdm *cpuDeviceManager) Allocate(ctx context.Context, rqt *pluginapi.Alloca
 func (cdm *cpuDeviceManager) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
 	dpOptions := pluginapi.DevicePluginOptions{
 		PreStartRequired:                false,
-		GetPreferredAllocationAvailable: false,
+		GetPreferredAllocationAvailable: cdm.poolType == types.ExclusivePoolID,
 	}
 	return &dpOptions, nil
 }
@@ -185,40 +248,185 @@ func (cdm *cpuDeviceManager) Register(kubeletEndpoint, resourceName string) erro
 	return nil
 }
 
-func (cdm *cpuDeviceManager) GetPreferredAllocation(context.Context, *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	return &pluginapi.PreferredAllocationResponse{}, nil
+//GetPreferredAllocation packs exclusive CPU requests onto as few topology domains as possible
+//Cores are preferably selected from the same NUMA node, then from the same L3 cache domain, and finally from the same physical core sibling group
+//Shared pool devices are fractional CPU time units without topology, so kubelet is left to pick them on its own
+func (cdm *cpuDeviceManager) GetPreferredAllocation(ctx context.Context, rqt *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	resp := new(pluginapi.PreferredAllocationResponse)
+	if cdm.poolType != types.ExclusivePoolID {
+		return resp, nil
+	}
+	for _, container := range rqt.ContainerRequests {
+		preferredIDs := cdm.preferredAllocation(container.AvailableDeviceIDs, container.MustIncludeDeviceIDs, int(container.AllocationSize))
+		glog.Infof("Preferred allocation for request of %d CPUs: %v", container.AllocationSize, preferredIDs)
+		resp.ContainerResponses = append(resp.ContainerResponses, &pluginapi.ContainerPreferredAllocationResponse{DeviceIDs: preferredIDs})
+	}
+	return resp, nil
+}
+
+func (cdm *cpuDeviceManager) preferredAllocation(availableIDs, mustIncludeIDs []string, size int) []string {
+	chosenCPUs := make([]int, 0, size)
+	alreadyChosen := make(map[int]bool)
+	for _, id := range mustIncludeIDs {
+		cpuID, err := strconv.Atoi(id)
+		if err != nil || alreadyChosen[cpuID] || len(chosenCPUs) >= size {
+			continue
+		}
+		alreadyChosen[cpuID] = true
+		chosenCPUs = append(chosenCPUs, cpuID)
+	}
+	var freeCPUs []int
+	for _, id := range availableIDs {
+		cpuID, err := strconv.Atoi(id)
+		if err != nil || alreadyChosen[cpuID] {
+			continue
+		}
+		alreadyChosen[cpuID] = true
+		freeCPUs = append(freeCPUs, cpuID)
+	}
+	levels := []topologyLevel{cdm.numaNodeOf, cdm.cacheDomainOf, cdm.physicalCoreOf}
+	chosenCPUs = append(chosenCPUs, packCPUs(freeCPUs, chosenCPUs, size-len(chosenCPUs), levels)...)
+	preferredIDs := make([]string, 0, len(chosenCPUs))
+	for _, cpuID := range chosenCPUs {
+		preferredIDs = append(preferredIDs, strconv.Itoa(cpuID))
+	}
+	return preferredIDs
+}
+
+//packCPUs selects the needed number of CPUs from the free ones, descending through the topology levels one-by-one
+//On every level the domains already hosting chosen CPUs are preferred, then the smallest domain still able to fit the whole request,
+//and when none of them can fit it the request is spilled over the largest domains first
+func packCPUs(freeCPUs, chosenCPUs []int, needed int, levels []topologyLevel) []int {
+	if needed <= 0 {
+		return nil
+	}
+	if len(levels) == 0 || len(freeCPUs) <= needed {
+		sort.Ints(freeCPUs)
+		if len(freeCPUs) > needed {
+			return freeCPUs[:needed]
+		}
+		return freeCPUs
+	}
+	level := levels[0]
+	domains := make(map[int][]int)
+	for _, cpuID := range freeCPUs {
+		domains[level(cpuID)] = append(domains[level(cpuID)], cpuID)
+	}
+	preferredDomains := make(map[int]bool)
+	for _, cpuID := range chosenCPUs {
+		preferredDomains[level(cpuID)] = true
+	}
+	domainIDs := make([]int, 0, len(domains))
+	for domainID := range domains {
+		domainIDs = append(domainIDs, domainID)
+	}
+	sort.Slice(domainIDs, func(i, j int) bool {
+		iDomain, jDomain := domainIDs[i], domainIDs[j]
+		if preferredDomains[iDomain] != preferredDomains[jDomain] {
+			return preferredDomains[iDomain]
+		}
+		iSize, jSize := len(domains[iDomain]), len(domains[jDomain])
+		iFits, jFits := iSize >= needed, jSize >= needed
+		if iFits != jFits {
+			return iFits
+		}
+		if iSize != jSize {
+			//Best fit among the domains which can host the whole request, biggest first among the ones which cannot
+			return iFits == (iSize < jSize)
+		}
+		return iDomain < jDomain
+	})
+	var pickedCPUs []int
+	for _, domainID := range domainIDs {
+		pickedCPUs = append(pickedCPUs, packCPUs(domains[domainID], chosenCPUs, needed-len(pickedCPUs), levels[1:])...)
+		if len(pickedCPUs) >= needed {
+			break
+		}
+	}
+	return pickedCPUs
+}
+
+func (cdm *cpuDeviceManager) numaNodeOf(cpuID int) int {
+	if numaNode, exists := cdm.nodeTopology[cpuID]; exists {
+		return numaNode
+	}
+	return -1
+}
+
+func (cdm *cpuDeviceManager) cacheDomainOf(cpuID int) int {
+	if cacheID, exists := cdm.cacheTopology[cpuID]; exists {
+		return cacheID
+	}
+	return -1
+}
+
+//physicalCoreOf returns the ID of the physical core the CPU belongs to, which is the CPU's own ID unless it is a HT sibling
+func (cdm *cpuDeviceManager) physicalCoreOf(cpuID int) int {
+	if _, isPhysical := cdm.htTopology[cpuID]; isPhysical {
+		return cpuID
+	}
+	for physicalCoreID, siblings := range cdm.htTopology {
+		siblingSet, err := cpuset.Parse(siblings)
+		if err == nil && siblingSet.Contains(cpuID) {
+			return physicalCoreID
+		}
+	}
+	return cpuID
 }
 
-func newCPUDeviceManager(poolName string, pool types.Pool, sharedCPUs string) *cpuDeviceManager {
+func newCPUDeviceManager(poolName string, pool types.Pool) *cpuDeviceManager {
 	glog.Infof("Starting plugin for pool: %s", poolName)
+	cpuTopology, err := topology.GetTopology()
+	if err != nil {
+		glog.Errorf("CPU topology could not be read from sysfs, pool: %s is advertised without topology information: %v", poolName, err)
+	}
 	return &cpuDeviceManager{
-		pool:           pool,
-		socketFile:     fmt.Sprintf("cpudp_%s.sock", poolName),
-		sharedPoolCPUs: sharedCPUs,
-		poolType:       types.DeterminePoolType(poolName),
-		nodeTopology:   topology.GetNodeTopology(),
-		htTopology:     topology.GetHTTopology(),
+		poolName:      poolName,
+		pool:          pool,
+		unhealthyCPUs: cpuset.NewCPUSet(),
+		updateChan:    make(chan struct{}, 1),
+		stopChan:      make(chan struct{}),
+		socketFile:    fmt.Sprintf("cpudp_%s.sock", poolName),
+		poolType:      types.DeterminePoolType(poolName),
+		nodeTopology:  cpuTopology.NUMANodes(),
+		htTopology:    cpuTopology.HTSiblings(),
+		cacheTopology: cpuTopology.CacheDomains(),
 	}
 }
 
-func validatePools(poolConf types.PoolConfig) (string, error) {
-	var sharedCPUs string
-	var err error
+//validatePools makes sure the millicore devices of multiple shared pools are not backed by the same physical CPUs
+//Overlapping shared pools would advertise the capacity of the common CPUs more than once
+func validatePools(poolConf types.PoolConfig) error {
+	sharedPoolOfCPUs := map[int]string{}
 	for poolName, pool := range poolConf.Pools {
-		poolType := types.DeterminePoolType(poolName)
-		if poolType == types.SharedPoolID {
-			if sharedCPUs != "" {
-				err = fmt.Errorf("Only one shared pool allowed")
+		if types.DeterminePoolType(poolName) != types.SharedPoolID {
+			continue
+		}
+		for _, cpu := range pool.CPUset.ToSlice() {
+			if otherPool, exists := sharedPoolOfCPUs[cpu]; exists {
 				glog.Errorf("Pool config : %v", poolConf)
-				break
+				return fmt.Errorf("CPU %d is assigned to both shared pools %s and %s", cpu, otherPool, poolName)
 			}
-			sharedCPUs = pool.CPUset.String()
+			sharedPoolOfCPUs[cpu] = poolName
 		}
 	}
-	return sharedCPUs, err
+	return nil
+}
+
+func setCDMs(newCdms []*cpuDeviceManager) {
+	cdmsLock.Lock()
+	defer cdmsLock.Unlock()
+	cdms = newCdms
 }
 
-func createCDMs(poolConf types.PoolConfig, sharedCPUs string) error {
+//runningCDMs returns a snapshot of the running plugins, and is safe to be called outside of the main loop
+func runningCDMs() []*cpuDeviceManager {
+	cdmsLock.RLock()
+	defer cdmsLock.RUnlock()
+	return append([]*cpuDeviceManager{}, cdms...)
+}
+
+func createCDMs(poolConf types.PoolConfig) error {
 	var err error
 	for poolName, pool := range poolConf.Pools {
 		poolType := types.DeterminePoolType(poolName)
@@ -226,26 +434,34 @@ func createCDMs(poolConf types.PoolConfig, sharedCPUs string) error {
 		if poolType == types.DefaultPoolID {
 			continue
 		}
-		cdm := newCPUDeviceManager(poolName, pool, sharedCPUs)
-		cdms = append(cdms, cdm)
-		if err := cdm.Start(); err != nil {
-			glog.Errorf("cpuDeviceManager.Start() failed: %v", err)
-			break
-		}
-		resourceName := resourceBaseName + "/" + poolName
-		err := cdm.Register(path.Join(pluginapi.DevicePluginPath, "kubelet.sock"), resourceName)
-		if err != nil {
-			// Stop server
-			cdm.grpcServer.Stop()
-			glog.Error(err)
+		if err = startCDM(poolName, pool); err != nil {
 			break
 		}
-		glog.Infof("CPU device plugin registered with the Kubelet")
 	}
 	return err
 }
 
-func createPluginsForPools() error {
+func startCDM(poolName string, pool types.Pool) error {
+	cdm := newCPUDeviceManager(poolName, pool)
+	setCDMs(append(cdms, cdm))
+	if err := cdm.Start(); err != nil {
+		glog.Errorf("cpuDeviceManager.Start() failed: %v", err)
+		return err
+	}
+	resourceName := resourceBaseName + "/" + poolName
+	err := cdm.Register(kubeletSocket, resourceName)
+	observeRegistration(poolName, err)
+	if err != nil {
+		// Stop server
+		cdm.grpcServer.Stop()
+		glog.Error(err)
+		return err
+	}
+	glog.Infof("CPU device plugin registered with the Kubelet")
+	return nil
+}
+
+func createPluginsForPools(previousPools map[string]types.Pool) error {
 	files, err := filepath.Glob(filepath.Join(pluginapi.DevicePluginPath, "cpudp*"))
 	if err != nil {
 		glog.Fatal(err)
@@ -260,14 +476,18 @@ func createPluginsForPools() error {
 		glog.Fatal(err)
 	}
 	glog.Infof("Pool configuration %v", poolConf)
+	return createPluginsForPoolConfig(previousPools, poolConf)
+}
 
-	var sharedCPUs string
-	sharedCPUs, err = validatePools(poolConf)
+//createPluginsForPoolConfig starts the plugins of a pool configuration, once it is extended with the CPUs still allocated from the pools advertised before a kubelet restart
+//Same as for reloads, the extended configuration is the one validated
+func createPluginsForPoolConfig(previousPools map[string]types.Pool, poolConf types.PoolConfig) error {
+	poolConf = effectivePoolConfig(previousPools, poolConf)
+	err := validatePools(poolConf)
 	if err != nil {
 		return err
 	}
-
-	if err := createCDMs(poolConf, sharedCPUs); err != nil {
+	if err = createCDMs(poolConf); err != nil {
 		for _, cdm := range cdms {
 			cdm.Stop()
 		}
@@ -276,18 +496,31 @@ func createPluginsForPools() error {
 }
 
 func main() {
+	flag.StringVar(&metricsAddress, "metrics-address", metricsAddress, "Address the Prometheus metrics are served on under the /metrics path. Metrics are not served when empty.")
 	flag.Parse()
+	serveMetrics()
 	watcher, _ := fsnotify.NewWatcher()
-	watcher.Add(path.Join(pluginapi.DevicePluginPath, "kubelet.sock"))
+	//The directory is watched, as the watch of the socket itself would not survive its re-creation by a restarted kubelet
+	watcher.Add(pluginapi.DevicePluginPath)
 	defer watcher.Close()
+	poolConfigWatcher, _ := fsnotify.NewWatcher()
+	//ConfigMap updates atomically swap a symlink in the mounted directory, so the directory itself needs to be watched
+	poolConfigWatcher.Add(types.PoolConfigDir)
+	defer poolConfigWatcher.Close()
+	var poolReloadTimer <-chan time.Time
+	poolShrinkTicker := time.NewTicker(poolShrinkRetryPeriod)
+	defer poolShrinkTicker.Stop()
+	healthCheckTicker := time.NewTicker(healthCheckPeriod)
+	defer healthCheckTicker.Stop()
 
 	// respond to syscalls for termination
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-	if err := createPluginsForPools(); err != nil {
+	if err := createPluginsForPools(nil); err != nil {
 		glog.Fatalf("Failed to start device plugin: %v", err)
 	}
+	checkDeviceHealth()
 
 	/* Monitor file changes for kubelet socket file and termination signals */
 	for {
@@ -304,14 +537,44 @@ func main() {
 			glog.Infof("Received signal \"%v\"", sig)
 
 		case event := <-watcher.Events:
+			if event.Name != kubeletSocket {
+				//The sockets of the plugins live in the same directory
+				continue
+			}
 			glog.Infof("Kubelet change event in pluginpath %v", event)
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				kubeletRestarts.Inc()
+			}
+			previousPools := activePools()
 			for _, cdm := range cdms {
 				cdm.Stop()
 			}
-			cdms = nil
-			if err := createPluginsForPools(); err != nil {
+			setCDMs(nil)
+			if err := createPluginsForPools(previousPools); err != nil {
 				panic("Failed to restart device plugin")
 			}
+
+		case event := <-poolConfigWatcher.Events:
+			glog.V(2).Infof("Pool configuration change event %v", event)
+			//One ConfigMap update generates a burst of events, the pools are only reloaded once it is over
+			poolReloadTimer = time.After(poolReloadDelay)
+
+		case <-poolReloadTimer:
+			poolReloadTimer = nil
+			if err := reloadPools(); err != nil {
+				glog.Errorf("Pool configuration could not be reloaded, keeping the active pools: %v", err)
+			}
+
+		case <-healthCheckTicker.C:
+			checkDeviceHealth()
+
+		case <-poolShrinkTicker.C:
+			if !poolShrinkPending {
+				continue
+			}
+			if err := reloadPools(); err != nil {
+				glog.Errorf("Pool configuration could not be reloaded, keeping the active pools: %v", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/net/context"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+//Two NUMA nodes, two L3 cache domains per node, physical cores 0-7 with HT siblings 8-15
+var testCdm = cpuDeviceManager{
+	poolType: types.ExclusivePoolID,
+	nodeTopology: map[int]int{0: 0, 1: 0, 2: 0, 3: 0, 4: 1, 5: 1, 6: 1, 7: 1,
+		8: 0, 9: 0, 10: 0, 11: 0, 12: 1, 13: 1, 14: 1, 15: 1},
+	cacheTopology: map[int]int{0: 0, 1: 0, 2: 1, 3: 1, 4: 2, 5: 2, 6: 3, 7: 3,
+		8: 0, 9: 0, 10: 1, 11: 1, 12: 2, 13: 2, 14: 3, 15: 3},
+	htTopology: map[int]string{0: "8", 1: "9", 2: "10", 3: "11", 4: "12", 5: "13", 6: "14", 7: "15"},
+}
+
+var preferredAllocationTcs = []struct {
+	name        string
+	available   []string
+	mustInclude []string
+	size        int
+	expected    []string
+}{
+	{"same_cache_domain", []string{"0", "1", "2", "3", "4", "5", "6", "7"}, nil, 2, []string{"0", "1"}},
+	{"best_fitting_numa_node", []string{"0", "2", "4", "5", "6"}, nil, 3, []string{"4", "5", "6"}},
+	{"follow_must_include", []string{"0", "1", "2", "5", "6", "7"}, []string{"6"}, 2, []string{"6", "7"}},
+	{"siblings_together", []string{"0", "1", "8", "9"}, nil, 2, []string{"0", "8"}},
+	{"spill_over_numa_nodes", []string{"0", "1", "2", "3", "4", "5", "6", "7"}, nil, 6, []string{"0", "1", "2", "3", "4", "5"}},
+	{"must_include_exceeds_size", []string{"0", "1", "2"}, []string{"2", "1", "0"}, 2, []string{"2", "1"}},
+}
+
+func TestGetPreferredAllocation(t *testing.T) {
+	for _, tc := range preferredAllocationTcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rqt := &pluginapi.PreferredAllocationRequest{ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{
+				{AvailableDeviceIDs: tc.available, MustIncludeDeviceIDs: tc.mustInclude, AllocationSize: int32(tc.size)}}}
+			resp, err := testCdm.GetPreferredAllocation(context.Background(), rqt)
+			if err != nil {
+				t.Fatalf("GetPreferredAllocation failed: %v", err)
+			}
+			if len(resp.ContainerResponses) != 1 {
+				t.Fatalf("Expected one container response, got: %d", len(resp.ContainerResponses))
+			}
+			if !reflect.DeepEqual(resp.ContainerResponses[0].DeviceIDs, tc.expected) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) preferred allocation", tc.expected, resp.ContainerResponses[0].DeviceIDs)
+			}
+		})
+	}
+}
+
+func TestGetPreferredAllocationSharedPool(t *testing.T) {
+	sharedCdm := cpuDeviceManager{poolType: types.SharedPoolID}
+	opts, _ := sharedCdm.GetDevicePluginOptions(context.Background(), &pluginapi.Empty{})
+	if opts.GetPreferredAllocationAvailable {
+		t.Errorf("Preferred allocation unexpectedly advertised for shared pool")
+	}
+	rqt := &pluginapi.PreferredAllocationRequest{ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{
+		{AvailableDeviceIDs: []string{"0", "1", "2"}, AllocationSize: 2}}}
+	resp, _ := sharedCdm.GetPreferredAllocation(context.Background(), rqt)
+	if len(resp.ContainerResponses) != 0 {
+		t.Errorf("Preferred allocation unexpectedly returned for shared pool: %v", resp.ContainerResponses)
+	}
+}
+
+func TestValidatePools(t *testing.T) {
+	disjointPools := types.PoolConfig{Pools: map[string]types.Pool{
+		"shared_controlplane": {CPUset: cpuset.NewCPUSet(1, 2)},
+		"shared_dataplane":    {CPUset: cpuset.NewCPUSet(3, 4)},
+		"exclusive_caas":      {CPUset: cpuset.NewCPUSet(1, 5)},
+	}}
+	if err := validatePools(disjointPools); err != nil {
+		t.Errorf("Disjoint shared pools were rejected: %s", err.Error())
+	}
+	overlappingPools := types.PoolConfig{Pools: map[string]types.Pool{
+		"shared_controlplane": {CPUset: cpuset.NewCPUSet(1, 2)},
+		"shared_dataplane":    {CPUset: cpuset.NewCPUSet(2, 3)},
+	}}
+	if err := validatePools(overlappingPools); err == nil {
+		t.Errorf("Overlapping shared pools were accepted")
+	}
+}
+
+func TestAllocateSharedCPUsOfOwnPool(t *testing.T) {
+	sharedCdm := cpuDeviceManager{poolType: types.SharedPoolID, pool: types.Pool{CPUset: cpuset.NewCPUSet(3, 4)}}
+	rqt := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"3000", "3001"}}}}
+	resp, err := sharedCdm.Allocate(context.Background(), rqt)
+	if err != nil || len(resp.ContainerResponses) != 1 {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	if sharedCPUs := resp.ContainerResponses[0].Envs["SHARED_CPUS"]; sharedCPUs != "3-4" {
+		t.Errorf("SHARED_CPUS is not the cpuset of the allocating pool: %s", sharedCPUs)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nokia/CPU-Pooler/pkg/topology"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var (
+	//healthCheckPeriod controls how often the online and isolation state of the CPUs is re-read from sysfs
+	healthCheckPeriod = 5 * time.Second
+)
+
+//cpuState is the snapshot of the kernel's view on the CPUs relevant for device health
+type cpuState struct {
+	online   cpuset.CPUSet
+	isolated cpuset.CPUSet
+	nohzFull cpuset.CPUSet
+}
+
+func readCPUState() (cpuState, error) {
+	var state cpuState
+	var err error
+	if state.online, err = topology.GetOnlineCPUs(); err != nil {
+		return state, err
+	}
+	if state.isolated, err = topology.GetIsolatedCPUs(); err != nil {
+		return state, err
+	}
+	state.nohzFull, err = topology.GetNohzFullCPUs()
+	return state, err
+}
+
+//checkDeviceHealth re-evaluates the health of the devices of all pools, and pushes the device lists of the changed pools to kubelet
+//Health is left untouched when the CPU state cannot be read, so a transient sysfs error does not take the whole pool down
+func checkDeviceHealth() {
+	state, err := readCPUState()
+	if err != nil {
+		glog.Errorf("CPU state could not be read, device health is not updated: %v", err)
+		return
+	}
+	for _, cdm := range cdms {
+		cdm.updateHealth(cdm.unhealthyCPUsIn(state))
+	}
+}
+
+//unhealthyCPUsIn returns the CPUs of the pool which are offline, or lack any of the isolation required by an exclusive pool
+func (cdm *cpuDeviceManager) unhealthyCPUsIn(state cpuState) cpuset.CPUSet {
+	pool := cdm.getPool()
+	poolCPUs := pool.CPUset
+	if pool.HTPolicy == types.MultiThreadHTPolicy {
+		poolCPUs = topology.AddHTSiblingsToCPUSet(poolCPUs, cdm.htTopology)
+	}
+	unhealthyCPUs := poolCPUs.Difference(state.online)
+	if cdm.poolType != types.ExclusivePoolID {
+		return unhealthyCPUs
+	}
+	for _, isolation := range pool.RequiredIsolation {
+		switch isolation {
+		case types.IsolcpusIsolation:
+			unhealthyCPUs = unhealthyCPUs.Union(poolCPUs.Difference(state.isolated))
+		case types.NohzFullIsolation:
+			unhealthyCPUs = unhealthyCPUs.Union(poolCPUs.Difference(state.nohzFull))
+		}
+	}
+	return unhealthyCPUs
+}
+
+func (cdm *cpuDeviceManager) getUnhealthyCPUs() cpuset.CPUSet {
+	cdm.poolLock.RLock()
+	defer cdm.poolLock.RUnlock()
+	return cdm.unhealthyCPUs
+}
+
+//updateHealth records the unhealthy CPUs of the pool, and signals the open ListAndWatch stream in case the set changed
+func (cdm *cpuDeviceManager) updateHealth(unhealthyCPUs cpuset.CPUSet) {
+	cdm.poolLock.Lock()
+	changed := !cdm.unhealthyCPUs.Equals(unhealthyCPUs)
+	cdm.unhealthyCPUs = unhealthyCPUs
+	cdm.poolLock.Unlock()
+	if !changed {
+		return
+	}
+	if unhealthyCPUs.IsEmpty() {
+		glog.Infof("All CPUs of pool: %s are healthy again", cdm.poolName)
+	} else {
+		glog.Warningf("CPUs: %s of pool: %s are offline or not isolated as required, reporting them unhealthy", unhealthyCPUs.String(), cdm.poolName)
+	}
+	cdm.notifyUpdate()
+}
+
+//isExclusiveCoreUnhealthy also takes the HT siblings into account for multi threaded pools, as they are handed out together with the device
+func (cdm *cpuDeviceManager) isExclusiveCoreUnhealthy(cpuID int, pool types.Pool, unhealthyCPUs cpuset.CPUSet) bool {
+	if unhealthyCPUs.Contains(cpuID) {
+		return true
+	}
+	if pool.HTPolicy != types.MultiThreadHTPolicy {
+		return false
+	}
+	siblings := topology.AddHTSiblingsToCPUSet(cpuset.NewCPUSet(cpuID), cdm.htTopology)
+	return !siblings.Intersection(unhealthyCPUs).IsEmpty()
+}
+
+func deviceHealth(unhealthy bool) string {
+	if unhealthy {
+		return pluginapi.Unhealthy
+	}
+	return pluginapi.Healthy
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/topology"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func setupCPUSysfs(t *testing.T, online, isolated, nohzFull string) {
+	sysfsRoot := t.TempDir()
+	cpuSysfsPath := filepath.Join(sysfsRoot, "devices/system/cpu")
+	if err := os.MkdirAll(cpuSysfsPath, 0755); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	for fileName, content := range map[string]string{"online": online, "isolated": isolated, "nohz_full": nohzFull} {
+		if err := ioutil.WriteFile(filepath.Join(cpuSysfsPath, fileName), []byte(content+"\n"), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = sysfsRoot
+	t.Cleanup(func() { topology.SysfsRoot = originalRoot })
+}
+
+//setupSysfsFixture makes the topology of the plugin come from a fixture instead of the host running the tests
+func setupSysfsFixture(t *testing.T) {
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = "../../test/testdata/sysfs/dual-socket-ht"
+	t.Cleanup(func() { topology.SysfsRoot = originalRoot })
+}
+
+func unhealthyDeviceIDs(devices []*pluginapi.Device) []string {
+	unhealthyIDs := []string{}
+	for _, device := range devices {
+		if device.Health == pluginapi.Unhealthy {
+			unhealthyIDs = append(unhealthyIDs, device.ID)
+		}
+	}
+	return unhealthyIDs
+}
+
+var deviceHealthTcs = []struct {
+	name              string
+	poolName          string
+	pool              types.Pool
+	online            string
+	isolated          string
+	nohzFull          string
+	expectedUnhealthy int
+	expectedFirstID   string
+}{
+	{"exclusive_all_healthy", "exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3)}, "0-15", "", "(null)", 0, ""},
+	{"exclusive_offline", "exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3)}, "0-2,4-15", "", "(null)", 1, "3"},
+	{"exclusive_offline_sibling", "exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3), HTPolicy: types.MultiThreadHTPolicy}, "0-9,11-15", "", "(null)", 1, "2"},
+	{"exclusive_not_isolated", "exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3), RequiredIsolation: []string{types.IsolcpusIsolation}}, "0-15", "3", "(null)", 1, "2"},
+	{"exclusive_not_nohz_full", "exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3), RequiredIsolation: []string{types.NohzFullIsolation}}, "0-15", "", "(null)", 2, "2"},
+	{"shared_isolation_ignored", "shared_caas", types.Pool{CPUset: cpuset.NewCPUSet(4, 5), RequiredIsolation: []string{types.IsolcpusIsolation}}, "0-15", "", "(null)", 0, ""},
+	{"shared_offline", "shared_caas", types.Pool{CPUset: cpuset.NewCPUSet(4, 5)}, "0-4,6-15", "", "(null)", 1000, "1000"},
+}
+
+func TestCheckDeviceHealth(t *testing.T) {
+	defer func(originalCdms []*cpuDeviceManager) { cdms = originalCdms }(cdms)
+	for _, tc := range deviceHealthTcs {
+		t.Run(tc.name, func(t *testing.T) {
+			setupCPUSysfs(t, tc.online, tc.isolated, tc.nohzFull)
+			cdm := newCPUDeviceManager(tc.poolName, tc.pool)
+			cdm.htTopology = testCdm.htTopology
+			cdms = []*cpuDeviceManager{cdm}
+			checkDeviceHealth()
+			unhealthyIDs := unhealthyDeviceIDs(cdm.devices())
+			if len(unhealthyIDs) != tc.expectedUnhealthy || (len(unhealthyIDs) > 0 && unhealthyIDs[0] != tc.expectedFirstID) {
+				t.Errorf("Expected %d unhealthy devices starting from: %s, got: %d %v", tc.expectedUnhealthy, tc.expectedFirstID, len(unhealthyIDs), unhealthyIDs)
+			}
+			updateSignalled := len(cdm.updateChan) == 1
+			if updateSignalled != (tc.expectedUnhealthy > 0) {
+				t.Errorf("ListAndWatch update signal (%t) does not follow health change", updateSignalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	metricsNamespace = "cpu_pooler"
+	metricsSubsystem = "device_plugin"
+)
+
+var (
+	metricsAddress  = ":9555"
+	metricsRegistry = prometheus.NewRegistry()
+	//getAllocatedDeviceIDsPerResource reads the allocations of all the pools with one call to kubelet per scrape
+	getAllocatedDeviceIDsPerResource = podResourcesClient.GetAllocatedDeviceIDsPerResource
+
+	allocateRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "allocate_requests_total",
+		Help:      "Number of Allocate calls received from kubelet.",
+	}, []string{"pool"})
+	allocateErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "allocate_errors_total",
+		Help:      "Number of Allocate calls answered with an error.",
+	}, []string{"pool"})
+	allocateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "allocate_duration_seconds",
+		Help:      "Latency of the Allocate calls received from kubelet.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"pool"})
+	registrationAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "registration_attempts_total",
+		Help:      "Number of attempts to register the plugin of a pool with kubelet, by result.",
+	}, []string{"pool", "result"})
+	kubeletRestarts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "kubelet_restarts_total",
+		Help:      "Number of kubelet restarts observed through re-creations of the kubelet socket.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(allocateRequests, allocateErrors, allocateDuration, registrationAttempts, kubeletRestarts, poolCollector{})
+	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+var (
+	exclusiveCapacityDesc    = newPoolDesc("exclusive_cores_capacity", "Number of cores of an exclusive pool.")
+	exclusiveAllocatableDesc = newPoolDesc("exclusive_cores_allocatable", "Number of healthy cores of an exclusive pool.")
+	exclusiveAllocatedDesc   = newPoolDesc("exclusive_cores_allocated", "Number of cores of an exclusive pool allocated to containers.")
+	sharedCapacityDesc       = newPoolDesc("shared_millicores_capacity", "Number of millicores of a shared pool.")
+	sharedAllocatableDesc    = newPoolDesc("shared_millicores_allocatable", "Number of healthy millicores of a shared pool.")
+	sharedAllocatedDesc      = newPoolDesc("shared_millicores_allocated", "Number of millicores of a shared pool allocated to containers.")
+)
+
+func newPoolDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "pool", name), help, []string{"pool"}, nil)
+}
+
+//poolCollector reports the capacity and usage of the pools of the running plugins whenever the metrics are scraped
+//Allocations are read from kubelet once per scrape, so they always reflect the current state of the Node
+type poolCollector struct{}
+
+func (poolCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{exclusiveCapacityDesc, exclusiveAllocatableDesc, exclusiveAllocatedDesc, sharedCapacityDesc, sharedAllocatableDesc, sharedAllocatedDesc} {
+		descs <- desc
+	}
+}
+
+func (poolCollector) Collect(metrics chan<- prometheus.Metric) {
+	allocatedDeviceIDs, err := getAllocatedDeviceIDsPerResource()
+	if err != nil {
+		glog.Warningf("Allocations of the pools could not be read for metrics: %v", err)
+	}
+	for _, cdm := range runningCDMs() {
+		capacityDesc, allocatableDesc, allocatedDesc := exclusiveCapacityDesc, exclusiveAllocatableDesc, exclusiveAllocatedDesc
+		if cdm.poolType == types.SharedPoolID {
+			capacityDesc, allocatableDesc, allocatedDesc = sharedCapacityDesc, sharedAllocatableDesc, sharedAllocatedDesc
+		}
+		devices := cdm.devices()
+		healthyDevices := 0
+		for _, device := range devices {
+			if device.Health == pluginapi.Healthy {
+				healthyDevices++
+			}
+		}
+		metrics <- prometheus.MustNewConstMetric(capacityDesc, prometheus.GaugeValue, float64(len(devices)), cdm.poolName)
+		metrics <- prometheus.MustNewConstMetric(allocatableDesc, prometheus.GaugeValue, float64(healthyDevices), cdm.poolName)
+		if err != nil {
+			continue
+		}
+		allocatedIDs := allocatedDeviceIDs[resourceBaseName+"/"+cdm.poolName]
+		metrics <- prometheus.MustNewConstMetric(allocatedDesc, prometheus.GaugeValue, float64(len(allocatedIDs)), cdm.poolName)
+	}
+}
+
+//observeAllocate records the outcome of one Allocate call of a pool
+func observeAllocate(poolName string, start time.Time, err error) {
+	allocateRequests.WithLabelValues(poolName).Inc()
+	allocateDuration.WithLabelValues(poolName).Observe(time.Since(start).Seconds())
+	if err != nil {
+		allocateErrors.WithLabelValues(poolName).Inc()
+	}
+}
+
+func observeRegistration(poolName string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	registrationAttempts.WithLabelValues(poolName, result).Inc()
+}
+
+//serveMetrics exposes the metrics of the plugin on the /metrics path of metricsAddress, unless the address is empty
+func serveMetrics() {
+	if metricsAddress == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.ListenAndServe(metricsAddress, mux); err != nil {
+			glog.Errorf("Metrics endpoint could not be served on: %s: %v", metricsAddress, err)
+		}
+	}()
+}
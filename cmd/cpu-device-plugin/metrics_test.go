@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/context"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func TestPoolMetrics(t *testing.T) {
+	setupSysfsFixture(t)
+	defer func(originalCdms []*cpuDeviceManager) { setCDMs(originalCdms) }(cdms)
+	defer func(original func() (map[string][]string, error)) { getAllocatedDeviceIDsPerResource = original }(getAllocatedDeviceIDsPerResource)
+	exclusiveCdm := newCPUDeviceManager("exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3, 4, 5)})
+	exclusiveCdm.unhealthyCPUs = cpuset.NewCPUSet(5)
+	sharedCdm := newCPUDeviceManager("shared_caas", types.Pool{CPUset: cpuset.NewCPUSet(6, 7)})
+	idleCdm := newCPUDeviceManager("exclusive_idle", types.Pool{CPUset: cpuset.NewCPUSet(8)})
+	setCDMs([]*cpuDeviceManager{exclusiveCdm, sharedCdm, idleCdm})
+	kubeletCalls := 0
+	getAllocatedDeviceIDsPerResource = func() (map[string][]string, error) {
+		kubeletCalls++
+		return map[string][]string{
+			"nokia.k8s.io/exclusive_caas": {"2", "4"},
+			"nokia.k8s.io/shared_caas":    {"0", "1", "2"},
+		}, nil
+	}
+	expected := `
+# HELP cpu_pooler_pool_exclusive_cores_allocatable Number of healthy cores of an exclusive pool.
+# TYPE cpu_pooler_pool_exclusive_cores_allocatable gauge
+cpu_pooler_pool_exclusive_cores_allocatable{pool="exclusive_caas"} 3
+cpu_pooler_pool_exclusive_cores_allocatable{pool="exclusive_idle"} 1
+# HELP cpu_pooler_pool_exclusive_cores_allocated Number of cores of an exclusive pool allocated to containers.
+# TYPE cpu_pooler_pool_exclusive_cores_allocated gauge
+cpu_pooler_pool_exclusive_cores_allocated{pool="exclusive_caas"} 2
+cpu_pooler_pool_exclusive_cores_allocated{pool="exclusive_idle"} 0
+# HELP cpu_pooler_pool_exclusive_cores_capacity Number of cores of an exclusive pool.
+# TYPE cpu_pooler_pool_exclusive_cores_capacity gauge
+cpu_pooler_pool_exclusive_cores_capacity{pool="exclusive_caas"} 4
+cpu_pooler_pool_exclusive_cores_capacity{pool="exclusive_idle"} 1
+# HELP cpu_pooler_pool_shared_millicores_allocatable Number of healthy millicores of a shared pool.
+# TYPE cpu_pooler_pool_shared_millicores_allocatable gauge
+cpu_pooler_pool_shared_millicores_allocatable{pool="shared_caas"} 2000
+# HELP cpu_pooler_pool_shared_millicores_allocated Number of millicores of a shared pool allocated to containers.
+# TYPE cpu_pooler_pool_shared_millicores_allocated gauge
+cpu_pooler_pool_shared_millicores_allocated{pool="shared_caas"} 3
+# HELP cpu_pooler_pool_shared_millicores_capacity Number of millicores of a shared pool.
+# TYPE cpu_pooler_pool_shared_millicores_capacity gauge
+cpu_pooler_pool_shared_millicores_capacity{pool="shared_caas"} 2000
+`
+	if err := testutil.CollectAndCompare(poolCollector{}, strings.NewReader(expected)); err != nil {
+		t.Errorf("Unexpected pool metrics: %v", err)
+	}
+	if kubeletCalls != 1 {
+		t.Errorf("Allocations of the pools should be read from kubelet once per scrape, were read %d times", kubeletCalls)
+	}
+	getAllocatedDeviceIDsPerResource = func() (map[string][]string, error) {
+		return nil, errors.New("podresources socket not found")
+	}
+	if count := testutil.CollectAndCount(poolCollector{}); count != 6 {
+		t.Errorf("Only the capacity and allocatable metrics of the 3 pools should be reported when the allocations cannot be read, got %d metrics", count)
+	}
+}
+
+func TestAllocateMetrics(t *testing.T) {
+	setupSysfsFixture(t)
+	cdm := newCPUDeviceManager("exclusive_metrics", types.Pool{CPUset: cpuset.NewCPUSet(2, 3)})
+	validRequest := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"2"}}}}
+	//Device IDs unknown to the pool are not validated, kubelet only asks for IDs the plugin advertised
+	unknownRequest := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"cpu"}}}}
+	if _, err := cdm.Allocate(context.Background(), validRequest); err != nil {
+		t.Fatalf("Valid allocation failed: %v", err)
+	}
+	if _, err := cdm.Allocate(context.Background(), unknownRequest); err != nil {
+		t.Errorf("Allocation of an unknown device ID failed: %v", err)
+	}
+	if requests := testutil.ToFloat64(allocateRequests.WithLabelValues("exclusive_metrics")); requests != 2 {
+		t.Errorf("Expected 2 Allocate calls to be counted, got: %v", requests)
+	}
+	if failures := testutil.ToFloat64(allocateErrors.WithLabelValues("exclusive_metrics")); failures != 0 {
+		t.Errorf("Expected no failed Allocate call to be counted, got: %v", failures)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/nokia/CPU-Pooler/pkg/podresources"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var (
+	//poolReloadDelay gives kubelet time to finish swapping all the files of an updated ConfigMap before the pools are reloaded
+	poolReloadDelay = 2 * time.Second
+	//poolShrinkRetryPeriod controls how often the configuration is re-applied while pools still contain removed, but allocated CPUs
+	poolShrinkRetryPeriod = 1 * time.Minute
+	poolShrinkPending     bool
+	podResourcesClient    = podresources.NewClient(podresources.DefaultSocket, podresources.DefaultCheckpointFile)
+	getAllocatedDeviceIDs = podResourcesClient.GetAllocatedDeviceIDs
+)
+
+//reloadPools re-reads the pool configuration of the Node, and applies it to the running plugins
+//Plugins of updated pools stream their new device lists to kubelet, plugins of new pools are started, and plugins of removed pools are stopped
+func reloadPools() error {
+	poolConf, err := types.DeterminePoolConfig()
+	if err != nil {
+		return err
+	}
+	return applyPoolConfig(poolConf)
+}
+
+//applyPoolConfig applies a pool configuration to the running plugins, once it is extended with the CPUs still allocated from the active pools
+//The extended configuration is the one validated, as the retained CPUs could make pools overlap which are disjoint in the configuration itself
+func applyPoolConfig(poolConf types.PoolConfig) error {
+	previousPools := activePools()
+	poolConf = effectivePoolConfig(previousPools, poolConf)
+	if err := validatePools(poolConf); err != nil {
+		return err
+	}
+	remainingCdms := make([]*cpuDeviceManager, 0, len(cdms))
+	for _, cdm := range cdms {
+		pool, exists := poolConf.Pools[cdm.poolName]
+		if !exists {
+			glog.Infof("Pool: %s was removed from the configuration, stopping its plugin", cdm.poolName)
+			cdm.Stop()
+			continue
+		}
+		cdm.updatePool(pool)
+		remainingCdms = append(remainingCdms, cdm)
+	}
+	setCDMs(remainingCdms)
+	for poolName, pool := range poolConf.Pools {
+		if _, running := previousPools[poolName]; running || types.DeterminePoolType(poolName) == types.DefaultPoolID {
+			continue
+		}
+		if err := startCDM(poolName, pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func activePools() map[string]types.Pool {
+	pools := make(map[string]types.Pool, len(cdms))
+	for _, cdm := range cdms {
+		pools[cdm.poolName] = cdm.getPool()
+	}
+	return pools
+}
+
+//effectivePoolConfig extends the pools of a freshly read configuration with the CPUs of the previously active pools still allocated to running containers
+//Such CPUs are only removed from their pool once they are released, which is re-evaluated every poolShrinkRetryPeriod
+func effectivePoolConfig(previousPools map[string]types.Pool, poolConf types.PoolConfig) types.PoolConfig {
+	effectiveConf := types.PoolConfig{Pools: make(map[string]types.Pool, len(poolConf.Pools)), NodeSelector: poolConf.NodeSelector}
+	for poolName, pool := range poolConf.Pools {
+		effectiveConf.Pools[poolName] = pool
+	}
+	poolShrinkPending = false
+	for poolName, previousPool := range previousPools {
+		pool, retained, err := retainAllocatedCPUs(poolName, previousPool, poolConf.Pools[poolName])
+		if err != nil {
+			glog.Errorf("Allocations of pool: %s could not be read, keeping its previous CPUs: %v", poolName, err)
+		}
+		poolShrinkPending = poolShrinkPending || retained
+		if !pool.CPUset.IsEmpty() {
+			effectiveConf.Pools[poolName] = pool
+		}
+	}
+	return effectiveConf
+}
+
+//retainAllocatedCPUs returns the new version of a pool, extended with the CPUs removed from it which are still allocated to running containers
+//The previous version of the pool is returned unchanged if its allocations cannot be read
+func retainAllocatedCPUs(poolName string, previousPool types.Pool, pool types.Pool) (types.Pool, bool, error) {
+	removedCPUs := previousPool.CPUset.Difference(pool.CPUset)
+	if removedCPUs.IsEmpty() {
+		return pool, false, nil
+	}
+	deviceIDs, err := getAllocatedDeviceIDs(resourceBaseName + "/" + poolName)
+	if err != nil {
+		return previousPool, true, err
+	}
+	var retainedCPUs cpuset.CPUSet
+	if types.DeterminePoolType(poolName) == types.SharedPoolID {
+		retainedCPUs = sharedCPUsToRetain(removedCPUs, pool.CPUset.Size(), deviceIDs)
+	} else {
+		retainedCPUs = removedCPUs.Intersection(exclusiveCPUsOf(deviceIDs))
+	}
+	if retainedCPUs.IsEmpty() {
+		return pool, false, nil
+	}
+	glog.Warningf("CPUs: %s removed from pool: %s are still allocated to running containers, they are kept in the pool until released", retainedCPUs.String(), poolName)
+	pool.CPUset = pool.CPUset.Union(retainedCPUs)
+	pool.CPUStr = pool.CPUset.String()
+	if pool.HTPolicy == "" {
+		pool.HTPolicy = previousPool.HTPolicy
+	}
+	return pool, true, nil
+}
+
+func exclusiveCPUsOf(deviceIDs []string) cpuset.CPUSet {
+	setBuilder := cpuset.NewBuilder()
+	for _, deviceID := range deviceIDs {
+		if cpuID, err := strconv.Atoi(deviceID); err == nil {
+			setBuilder.Add(cpuID)
+		}
+	}
+	return setBuilder.Result()
+}
+
+//Shared devices are millicores numbered from zero, so a shared pool has to keep as many CPUs as needed to still advertise the highest allocated device
+func sharedCPUsToRetain(removedCPUs cpuset.CPUSet, newPoolSize int, deviceIDs []string) cpuset.CPUSet {
+	highestDeviceID := -1
+	for _, deviceID := range deviceIDs {
+		if millicoreID, err := strconv.Atoi(deviceID); err == nil && millicoreID > highestDeviceID {
+			highestDeviceID = millicoreID
+		}
+	}
+	missingCPUs := highestDeviceID/1000 + 1 - newPoolSize
+	if highestDeviceID < 0 || missingCPUs <= 0 {
+		return cpuset.NewCPUSet()
+	}
+	removedCPUList := removedCPUs.ToSlice()
+	if missingCPUs > len(removedCPUList) {
+		missingCPUs = len(removedCPUList)
+	}
+	return cpuset.NewCPUSet(removedCPUList[:missingCPUs]...)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var retainAllocatedCPUsTcs = []struct {
+	name             string
+	poolName         string
+	previousCPUs     cpuset.CPUSet
+	newCPUs          cpuset.CPUSet
+	allocatedDevices []string
+	expectedCPUs     cpuset.CPUSet
+	expectedRetained bool
+}{
+	{"exclusive_grow", "exclusive_caas", cpuset.NewCPUSet(2, 3), cpuset.NewCPUSet(2, 3, 4, 5), []string{"2"}, cpuset.NewCPUSet(2, 3, 4, 5), false},
+	{"exclusive_shrink_free", "exclusive_caas", cpuset.NewCPUSet(2, 3, 4, 5), cpuset.NewCPUSet(2, 3), []string{"2", "3"}, cpuset.NewCPUSet(2, 3), false},
+	{"exclusive_shrink_allocated", "exclusive_caas", cpuset.NewCPUSet(2, 3, 4, 5), cpuset.NewCPUSet(2, 3), []string{"3", "5"}, cpuset.NewCPUSet(2, 3, 5), true},
+	{"exclusive_removed_allocated", "exclusive_caas", cpuset.NewCPUSet(2, 3), cpuset.NewCPUSet(), []string{"3"}, cpuset.NewCPUSet(3), true},
+	{"shared_shrink_free", "shared_caas", cpuset.NewCPUSet(6, 7, 8), cpuset.NewCPUSet(6), []string{"0", "999"}, cpuset.NewCPUSet(6), false},
+	{"shared_shrink_allocated", "shared_caas", cpuset.NewCPUSet(6, 7, 8), cpuset.NewCPUSet(6), []string{"0", "1500"}, cpuset.NewCPUSet(6, 7), true},
+}
+
+func TestRetainAllocatedCPUs(t *testing.T) {
+	defer func(original func(string) ([]string, error)) { getAllocatedDeviceIDs = original }(getAllocatedDeviceIDs)
+	for _, tc := range retainAllocatedCPUsTcs {
+		t.Run(tc.name, func(t *testing.T) {
+			getAllocatedDeviceIDs = func(resourceName string) ([]string, error) {
+				if resourceName != resourceBaseName+"/"+tc.poolName {
+					t.Errorf("Allocations of unexpected resource: %s were read", resourceName)
+				}
+				return tc.allocatedDevices, nil
+			}
+			pool, retained, err := retainAllocatedCPUs(tc.poolName, types.Pool{CPUset: tc.previousCPUs}, types.Pool{CPUset: tc.newCPUs})
+			if err != nil || retained != tc.expectedRetained || !pool.CPUset.Equals(tc.expectedCPUs) {
+				t.Errorf("Expected CPUs: %s (retained: %t), got: %s (retained: %t), error: %v", tc.expectedCPUs, tc.expectedRetained, pool.CPUset, retained, err)
+			}
+		})
+	}
+}
+
+type fakeListAndWatchServer struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *pluginapi.ListAndWatchResponse
+}
+
+func (stream *fakeListAndWatchServer) Send(resp *pluginapi.ListAndWatchResponse) error {
+	stream.responses <- resp
+	return nil
+}
+
+func (stream *fakeListAndWatchServer) Context() context.Context {
+	return stream.ctx
+}
+
+func receiveDevices(t *testing.T, stream *fakeListAndWatchServer) []*pluginapi.Device {
+	select {
+	case resp := <-stream.responses:
+		return resp.Devices
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ListAndWatch did not send the device list")
+	}
+	return nil
+}
+
+func TestListAndWatchStreamsPoolUpdates(t *testing.T) {
+	setupSysfsFixture(t)
+	cdm := newCPUDeviceManager("exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3)})
+	stream := &fakeListAndWatchServer{ctx: context.Background(), responses: make(chan *pluginapi.ListAndWatchResponse, 2)}
+	returned := make(chan error)
+	go func() { returned <- cdm.ListAndWatch(&pluginapi.Empty{}, stream) }()
+	if devices := receiveDevices(t, stream); len(devices) != 2 {
+		t.Errorf("Initial device list has %d devices instead of 2", len(devices))
+	}
+	cdm.updatePool(types.Pool{CPUset: cpuset.NewCPUSet(2, 3, 4)})
+	if devices := receiveDevices(t, stream); len(devices) != 3 {
+		t.Errorf("Updated device list has %d devices instead of 3", len(devices))
+	}
+	close(cdm.stopChan)
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Errorf("ListAndWatch returned with error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("ListAndWatch did not return after the plugin was stopped")
+	}
+}
+
+func TestApplyPoolConfigValidatesRetainedCPUs(t *testing.T) {
+	setupSysfsFixture(t)
+	defer func(originalCdms []*cpuDeviceManager) { setCDMs(originalCdms) }(cdms)
+	defer func(original func(string) ([]string, error)) { getAllocatedDeviceIDs = original }(getAllocatedDeviceIDs)
+	defer func(original bool) { poolShrinkPending = original }(poolShrinkPending)
+	sharedCdm := newCPUDeviceManager("shared_caas", types.Pool{CPUset: cpuset.NewCPUSet(6, 7)})
+	setCDMs([]*cpuDeviceManager{sharedCdm})
+	getAllocatedDeviceIDs = func(resourceName string) ([]string, error) {
+		return []string{"1500"}, nil
+	}
+	//CPU 7 moves to another shared pool, while the millicores it backs are still allocated from the original one
+	poolConf := types.PoolConfig{Pools: map[string]types.Pool{
+		"shared_caas":  {CPUset: cpuset.NewCPUSet(6)},
+		"shared_other": {CPUset: cpuset.NewCPUSet(7)},
+	}}
+	if err := applyPoolConfig(poolConf); err == nil {
+		t.Errorf("Configuration making the retained CPUs of a shared pool overlap with another shared pool was applied")
+	}
+	if pool := sharedCdm.getPool(); !pool.CPUset.Equals(cpuset.NewCPUSet(6, 7)) || len(runningCDMs()) != 1 {
+		t.Errorf("Active pools were modified by an invalid configuration, pool: %s, plugins: %d", pool.CPUset, len(runningCDMs()))
+	}
+}
+
+func TestCreatePluginsValidatesRetainedCPUs(t *testing.T) {
+	setupSysfsFixture(t)
+	defer func(originalCdms []*cpuDeviceManager) { setCDMs(originalCdms) }(cdms)
+	defer func(original func(string) ([]string, error)) { getAllocatedDeviceIDs = original }(getAllocatedDeviceIDs)
+	defer func(original bool) { poolShrinkPending = original }(poolShrinkPending)
+	setCDMs(nil)
+	getAllocatedDeviceIDs = func(resourceName string) ([]string, error) {
+		return []string{"1500"}, nil
+	}
+	//The pools advertised before the kubelet restart still back allocated millicores with CPU 7, which the new configuration moved to another shared pool
+	previousPools := map[string]types.Pool{"shared_caas": {CPUset: cpuset.NewCPUSet(6, 7)}}
+	poolConf := types.PoolConfig{Pools: map[string]types.Pool{
+		"shared_caas":  {CPUset: cpuset.NewCPUSet(6)},
+		"shared_other": {CPUset: cpuset.NewCPUSet(7)},
+	}}
+	if err := createPluginsForPoolConfig(previousPools, poolConf); err == nil {
+		t.Errorf("Plugins were created for a configuration making the retained CPUs of a shared pool overlap with another shared pool")
+	}
+	if len(runningCDMs()) != 0 {
+		t.Errorf("Plugins were started for an invalid configuration: %d", len(runningCDMs()))
+	}
+}
+
+func TestUpdatePoolReevaluatesRequiredIsolation(t *testing.T) {
+	setupCPUSysfs(t, "0-15", "3", "(null)")
+	cdm := newCPUDeviceManager("exclusive_caas", types.Pool{CPUset: cpuset.NewCPUSet(2, 3)})
+	cdm.htTopology = testCdm.htTopology
+	cdm.updatePool(types.Pool{CPUset: cpuset.NewCPUSet(2, 3), RequiredIsolation: []string{types.IsolcpusIsolation}})
+	if unhealthyIDs := unhealthyDeviceIDs(cdm.devices()); len(unhealthyIDs) != 1 || unhealthyIDs[0] != "2" {
+		t.Errorf("CPU not isolated as newly required by the pool should be unhealthy, unhealthy devices: %v", unhealthyIDs)
+	}
+	if len(cdm.updateChan) != 1 {
+		t.Errorf("ListAndWatch was not signalled about the changed required isolation")
+	}
+	cdm.updatePool(types.Pool{CPUset: cpuset.NewCPUSet(2, 3)})
+	if unhealthyIDs := unhealthyDeviceIDs(cdm.devices()); len(unhealthyIDs) != 0 {
+		t.Errorf("Devices should be healthy once the isolation is no longer required, unhealthy devices: %v", unhealthyIDs)
+	}
+}
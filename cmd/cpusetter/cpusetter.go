@@ -2,23 +2,29 @@ package main
 
 import (
 	"flag"
+	"github.com/fsnotify/fsnotify"
+	"github.com/nokia/CPU-Pooler/pkg/criclient"
 	"github.com/nokia/CPU-Pooler/pkg/sethandler"
 	"github.com/nokia/CPU-Pooler/pkg/types"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 const (
 	//NumberOfWorkers controls how many asynch event handler threads are started in the CPUSetter controller
 	NumberOfWorkers = 100
+	//PoolConfigReloadDelay controls how long we wait after the last change of the pool configuration files before re-reading them
+	PoolConfigReloadDelay = 2 * time.Second
 )
 
 var (
 	kubeConfig     string
 	poolConfigPath string
 	cpusetRoot     string
+	criSocket      string
 )
 
 func main() {
@@ -30,7 +36,7 @@ func main() {
 	if err != nil {
 		log.Fatal("ERROR: Could not read CPU pool configuration files because: " + err.Error() + ", exiting!")
 	}
-	setHandler, err := sethandler.New(kubeConfig, poolConf, cpusetRoot)
+	setHandler, err := sethandler.New(kubeConfig, poolConf, cpusetRoot, criSocket)
 	if err != nil {
 		log.Fatal("ERROR: Could not initalize K8s client because of error: " + err.Error() + ", exiting!")
 	}
@@ -39,16 +45,43 @@ func main() {
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
 	log.Println("CPUSetter's Controller initalized successfully!")
+	serveStatus(setHandler)
 	setHandler.Run(NumberOfWorkers, &stopChannel)
-	select {
-	case <-signalChannel:
-		log.Println("Orchestrator initiated graceful shutdown, ending CPUSetter workers...(o_o)/")
-		setHandler.Stop()
+	var poolConfigEvents chan fsnotify.Event
+	poolConfigWatcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer poolConfigWatcher.Close()
+		err = poolConfigWatcher.Add(poolConfigPath)
+		poolConfigEvents = poolConfigWatcher.Events
+	}
+	if err != nil {
+		log.Println("WARNING: Pool configuration changes cannot be watched because: " + err.Error() + ", they are only applied after restart")
+	}
+	var poolConfigReload <-chan time.Time
+	for {
+		select {
+		case <-poolConfigEvents:
+			poolConfigReload = time.After(PoolConfigReloadDelay)
+		case <-poolConfigReload:
+			poolConfigReload = nil
+			poolConf, err := types.DeterminePoolConfig()
+			if err != nil {
+				log.Println("WARNING: Could not re-read CPU pool configuration files because: " + err.Error() + ", keeping the active configuration")
+				continue
+			}
+			setHandler.UpdatePoolConfig(poolConf)
+		case <-signalChannel:
+			log.Println("Orchestrator initiated graceful shutdown, ending CPUSetter workers...(o_o)/")
+			setHandler.Stop()
+			return
+		}
 	}
 }
 
 func init() {
 	flag.StringVar(&poolConfigPath, "poolconfigs", "", "Path to the pool configuration files. Mandatory parameter.")
 	flag.StringVar(&cpusetRoot, "cpusetroot", "", "The root of the cgroupfs where Kubernetes creates the cpusets for the Pods . Mandatory parameter.")
+	flag.StringVar(&criSocket, "cri-socket", criclient.DefaultSocket, "Path to the CRI socket of the container runtime, used to locate the cgroups of the containers. Optional parameter, cgroupfs is searched for them when the socket does not exist.")
 	flag.StringVar(&kubeConfig, "kubeconfig", "", "Path to a kubeconfig. Optional parameter, only required if out-of-cluster.")
+	flag.StringVar(&metricsAddress, "metrics-address", metricsAddress, "Address of the Prometheus metrics, liveness and readiness endpoints. Optional parameter, empty value disables them.")
 }
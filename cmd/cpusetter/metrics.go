@@ -0,0 +1,55 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nokia/CPU-Pooler/pkg/sethandler"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metricsAddress  = ":9556"
+	metricsRegistry = prometheus.NewRegistry()
+)
+
+func init() {
+	if err := sethandler.RegisterMetrics(metricsRegistry); err != nil {
+		log.Fatal("ERROR: CPUSetter metrics could not be registered because: " + err.Error())
+	}
+	metricsRegistry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+}
+
+//newStatusHandler returns a handler answering 200 while the check passes, and 503 with the reason of the failure otherwise
+func newStatusHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+//newStatusMux routes the metrics, and the liveness and readiness checks of the controller
+func newStatusMux(setHandler *sethandler.SetHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", newStatusHandler(setHandler.Healthy))
+	mux.Handle("/readyz", newStatusHandler(setHandler.Ready))
+	return mux
+}
+
+//serveStatus exposes the metrics and health endpoints of CPUSetter on metricsAddress, unless the address is empty
+func serveStatus(setHandler *sethandler.SetHandler) {
+	if metricsAddress == "" {
+		return
+	}
+	mux := newStatusMux(setHandler)
+	go func() {
+		if err := http.ListenAndServe(metricsAddress, mux); err != nil {
+			log.Println("ERROR: Metrics and health endpoints could not be served on: " + metricsAddress + " because: " + err.Error())
+		}
+	}()
+}
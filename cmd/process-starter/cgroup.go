@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var (
+	procSelfCgroup = "/proc/self/cgroup"
+	cgroupRoot     = "/sys/fs/cgroup"
+	//terminationLogPath is where Kubernetes reads the termination message of the container from by default
+	terminationLogPath = "/dev/termination-log"
+)
+
+const (
+	//defaultCpusetWaitTimeout is used when the webhook did not inject CPUSET_WAIT_TIMEOUT into the container
+	defaultCpusetWaitTimeout = 30 * time.Second
+	cpusetPollInterval       = 1 * time.Second
+)
+
+//getCpusetFile returns the file showing the cpuset of process-starter's own cgroup.
+//On cgroup v1 it is the cpuset.cpus of the cpuset hierarchy, on cgroup v2 the cpuset.cpus.effective of the unified hierarchy.
+//The cgroup path read from /proc/self/cgroup is only valid under the cgroupfs mounted into the container when the
+//container has its own cgroup namespace, otherwise the root of the mount is already the cgroup of the container
+func getCpusetFile() (string, error) {
+	file, err := os.Open(procSelfCgroup)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	var candidates []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		//hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "0" && fields[1] == "" {
+			candidates = append(candidates,
+				filepath.Join(cgroupRoot, fields[2], "cpuset.cpus.effective"),
+				filepath.Join(cgroupRoot, "cpuset.cpus.effective"))
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpuset" {
+				//The v1 cpuset hierarchy takes precedence over the unified one on hybrid hosts
+				candidates = append([]string{
+					filepath.Join(cgroupRoot, "cpuset", fields[2], "cpuset.cpus"),
+					filepath.Join(cgroupRoot, "cpuset", "cpuset.cpus")}, candidates...)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		if _, err = os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("cpuset of the container could not be found under " + cgroupRoot + " based on " + procSelfCgroup)
+}
+
+func readCpuset(cpusetFile string) (cpuset.CPUSet, error) {
+	content, err := ioutil.ReadFile(cpusetFile)
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(content)))
+}
+
+//getCpusetWaitTimeout returns how long process-starter waits for the cpuset of the container to be provisioned
+func getCpusetWaitTimeout() time.Duration {
+	timeoutStr := os.Getenv("CPUSET_WAIT_TIMEOUT")
+	if timeoutStr == "" {
+		return defaultCpusetWaitTimeout
+	}
+	timeout, err := time.ParseDuration(timeoutStr)
+	if err != nil || timeout <= 0 {
+		fmt.Printf("Invalid CPUSET_WAIT_TIMEOUT env variable %s, waiting %v for the cpuset\n", timeoutStr, defaultCpusetWaitTimeout)
+		return defaultCpusetWaitTimeout
+	}
+	return timeout
+}
+
+//terminate prints the reason of the failure, and also writes it as the termination message of the container before exiting
+func terminate(message string) {
+	fmt.Println(message)
+	ioutil.WriteFile(terminationLogPath, []byte(message), 0644)
+	os.Exit(1)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetCpusetFile(t *testing.T) {
+	var tcs = []struct {
+		name         string
+		procCgroup   string
+		cpusetFiles  []string
+		expectedFile string
+	}{
+		{
+			name:         "v1_host_cgroup_path",
+			procCgroup:   "12:memory:/kubepods/pod1/cont1\n5:cpuset:/kubepods/pod1/cont1\n0::/\n",
+			cpusetFiles:  []string{"cpuset/cpuset.cpus"},
+			expectedFile: "cpuset/cpuset.cpus",
+		},
+		{
+			name:         "v1_cgroup_namespace",
+			procCgroup:   "5:cpuset:/kubepods/pod1/cont1\n",
+			cpusetFiles:  []string{"cpuset/cpuset.cpus", "cpuset/kubepods/pod1/cont1/cpuset.cpus"},
+			expectedFile: "cpuset/kubepods/pod1/cont1/cpuset.cpus",
+		},
+		{
+			name:         "v2_cgroup_namespace",
+			procCgroup:   "0::/\n",
+			cpusetFiles:  []string{"cpuset.cpus.effective"},
+			expectedFile: "cpuset.cpus.effective",
+		},
+		{
+			name:         "v2_host_cgroup_path",
+			procCgroup:   "0::/kubepods.slice/kubepods-pod1.slice/cri-containerd-cont1.scope\n",
+			cpusetFiles:  []string{"cpuset.cpus.effective"},
+			expectedFile: "cpuset.cpus.effective",
+		},
+		{
+			name:         "hybrid",
+			procCgroup:   "5:cpuset:/kubepods/pod1/cont1\n0::/kubepods/pod1/cont1\n",
+			cpusetFiles:  []string{"cpuset/cpuset.cpus", "cpuset.cpus.effective"},
+			expectedFile: "cpuset/cpuset.cpus",
+		},
+	}
+	originalProcSelfCgroup, originalCgroupRoot := procSelfCgroup, cgroupRoot
+	defer func() { procSelfCgroup, cgroupRoot = originalProcSelfCgroup, originalCgroupRoot }()
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			procSelfCgroup = filepath.Join(tempDir, "cgroup")
+			cgroupRoot = filepath.Join(tempDir, "sys/fs/cgroup")
+			if err := ioutil.WriteFile(procSelfCgroup, []byte(tc.procCgroup), 0644); err != nil {
+				t.Fatalf("Test suite setup failed: %s", err.Error())
+			}
+			for _, cpusetFile := range tc.cpusetFiles {
+				os.MkdirAll(filepath.Dir(filepath.Join(cgroupRoot, cpusetFile)), 0755)
+				if err := ioutil.WriteFile(filepath.Join(cgroupRoot, cpusetFile), []byte("2-3\n"), 0644); err != nil {
+					t.Fatalf("Test suite setup failed: %s", err.Error())
+				}
+			}
+			cpusetFile, err := getCpusetFile()
+			if err != nil || cpusetFile != filepath.Join(cgroupRoot, tc.expectedFile) {
+				t.Fatalf("Mismatch in expected (%s) vs actual (%s) cpuset file, error: %v", tc.expectedFile, cpusetFile, err)
+			}
+			cpus, err := readCpuset(cpusetFile)
+			if err != nil || cpus.String() != "2-3" {
+				t.Errorf("Cpuset could not be read from %s: %v, error: %v", cpusetFile, cpus, err)
+			}
+		})
+	}
+}
+
+func TestGetCpusetWaitTimeout(t *testing.T) {
+	var tcs = []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: defaultCpusetWaitTimeout},
+		{value: "2m", expected: 2 * time.Minute},
+		{value: "ten seconds", expected: defaultCpusetWaitTimeout},
+		{value: "-5s", expected: defaultCpusetWaitTimeout},
+	}
+	for _, tc := range tcs {
+		t.Setenv("CPUSET_WAIT_TIMEOUT", tc.value)
+		if timeout := getCpusetWaitTimeout(); timeout != tc.expected {
+			t.Errorf("Mismatch in expected (%v) vs actual (%v) timeout for CPUSET_WAIT_TIMEOUT=%s", tc.expected, timeout, tc.value)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var (
+	//podAnnotationsFile is where the webhook mounts the annotations of the Pod through the downward API
+	podAnnotationsFile = "/etc/podinfo/annotations"
+)
+
+//readPodAnnotations parses the downward API annotations file, where every annotation is a key="quoted value" line
+func readPodAnnotations() (map[string]string, error) {
+	file, err := os.Open(podAnnotationsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	annotations := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	//Annotations can be up to 256kB long
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		keyValue := strings.SplitN(scanner.Text(), "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		value, err := strconv.Unquote(keyValue[1])
+		if err != nil {
+			continue
+		}
+		annotations[keyValue[0]] = value
+	}
+	return annotations, scanner.Err()
+}
+
+//getProvisionedCpuset tells whether CPUSetter has already provisioned the cpuset of the container, and returns it if so.
+//The applied cpuset CPUSetter published for the container is only trusted once the cgroup of the container shows the same,
+//otherwise the entry may belong to a previous instance of a restarted container.
+//Without an entry for the container, the cpusets-configured marker of the Pod makes the cgroup of the container authoritative
+func getProvisionedCpuset(annotations map[string]string, containerName string, cgroupCpuset cpuset.CPUSet) (cpuset.CPUSet, bool) {
+	if appliedCpusets, err := types.DecodeCpusetAnnotation([]byte(annotations[types.CpusetAnnotationKey])); err == nil {
+		if appliedCpuset, exists := appliedCpusets.Container(containerName); exists {
+			appliedSet, err := cpuset.Parse(appliedCpuset.Cpuset)
+			if err != nil {
+				fmt.Printf("Cannot parse applied cpuset %s of the container: %v\n", appliedCpuset.Cpuset, err)
+				return cpuset.CPUSet{}, false
+			}
+			//CPUSetter leaves the cgroup of the container untouched when there is nothing to set
+			if appliedSet.IsEmpty() || appliedSet.Equals(cgroupCpuset) {
+				return cgroupCpuset, true
+			}
+			return cpuset.CPUSet{}, false
+		}
+	}
+	if annotations[types.CpusetsConfiguredAnnotationKey] == "true" {
+		return cgroupCpuset, true
+	}
+	return cpuset.CPUSet{}, false
+}
+
+//waitForProvisionedCpuset watches the annotations of the Pod until CPUSetter reports the cpuset of the container as provisioned.
+//The annotations file is also re-read periodically, in case its changes cannot be watched
+func waitForProvisionedCpuset(containerName string) cpuset.CPUSet {
+	cpusetFile, err := getCpusetFile()
+	if err != nil {
+		terminate(fmt.Sprintf("Cannot locate cgroup cpuset: %v", err))
+	}
+	var podinfoEvents chan fsnotify.Event
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		//The kubelet atomically replaces the whole content of the downward API volume, so the directory is watched
+		if err = watcher.Add(filepath.Dir(podAnnotationsFile)); err == nil {
+			podinfoEvents = watcher.Events
+		}
+	}
+	if err != nil {
+		fmt.Printf("Cannot watch %s, polling it instead: %v\n", podAnnotationsFile, err)
+	}
+	timeout := getCpusetWaitTimeout()
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(cpusetPollInterval)
+	defer ticker.Stop()
+	var cgroupCpuset cpuset.CPUSet
+	for {
+		annotations, err := readPodAnnotations()
+		if err != nil {
+			fmt.Printf("Cannot read pod annotations %s: %v\n", podAnnotationsFile, err)
+		}
+		cgroupCpuset, err = readCpuset(cpusetFile)
+		if err != nil {
+			fmt.Printf("Cannot read cgroup cpuset %s: %v\n", cpusetFile, err)
+		} else if provisionedCpuset, isProvisioned := getProvisionedCpuset(annotations, containerName, cgroupCpuset); isProvisioned {
+			fmt.Printf("Cgroup cpuset (%s) provisioned by CPUSetter\n", provisionedCpuset.String())
+			return provisionedCpuset
+		}
+		select {
+		case <-podinfoEvents:
+		case <-ticker.C:
+		case <-deadline:
+			terminate(fmt.Sprintf("Timed out after %v waiting for the cpuset of the container to be provisioned by CPUSetter: "+
+				"neither %s nor %s annotations report it as provisioned, cgroup cpuset is (%s) in %s",
+				timeout, types.CpusetAnnotationKey, types.CpusetsConfiguredAnnotationKey, cgroupCpuset.String(), cpusetFile))
+		}
+	}
+}
+
+//splitProvisionedCpuset divides the provisioned cpuset of the container between the processes of the exclusive, and of the shared pools.
+//The shared part is identified by the SHARED_CPUS of the container. Containers of the default pool pin all their processes to the whole cpuset
+func splitProvisionedCpuset(provisionedCpuset cpuset.CPUSet, poolType string, sharedCPUsEnv string) (exclusiveCPUs, sharedCPUs []int) {
+	switch poolType {
+	case types.ExclusivePoolID + "&" + types.SharedPoolID:
+		sharedCPUSet, err := cpuset.Parse(sharedCPUsEnv)
+		if err != nil {
+			fmt.Printf("Cannot parse SHARED_CPUS env variable, %v\n", err)
+		}
+		sharedCPUSet = provisionedCpuset.Intersection(sharedCPUSet)
+		exclusiveCPUs = provisionedCpuset.Difference(sharedCPUSet).ToSlice()
+		sharedCPUs = sharedCPUSet.ToSlice()
+	case types.ExclusivePoolID:
+		exclusiveCPUs = provisionedCpuset.ToSlice()
+	default:
+		sharedCPUs = provisionedCpuset.ToSlice()
+	}
+	fmt.Printf("Exclusive cpu list %v\n", exclusiveCPUs)
+	fmt.Printf("Shared cpu list %v\n", sharedCPUs)
+	return
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func appliedCpusetsAnnotation(t *testing.T, containers ...types.ContainerCpuset) string {
+	annotation, err := types.CpusetAnnotation(containers).Encode()
+	if err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	return annotation
+}
+
+//writePodAnnotations writes the annotations the same way the kubelet does into the downward API volume
+func writePodAnnotations(t *testing.T, annotations map[string]string) {
+	var content string
+	for key, value := range annotations {
+		content += key + "=" + strconv.Quote(value) + "\n"
+	}
+	if err := ioutil.WriteFile(podAnnotationsFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+}
+
+func TestReadPodAnnotations(t *testing.T) {
+	originalAnnotationsFile := podAnnotationsFile
+	defer func() { podAnnotationsFile = originalAnnotationsFile }()
+	podAnnotationsFile = filepath.Join(t.TempDir(), "annotations")
+	expected := map[string]string{
+		"nokia.k8s.io/cpus":                  `[{"container": "cputestcontainer", "processes": [{"process": "/bin/sh", "args": ["-c", "sleep \"1\""], "cpus": 1, "pool": "exclusive_caas"}]}]`,
+		types.CpusetAnnotationKey:            appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "cputestcontainer", Cpuset: "2-3"}),
+		types.CpusetsConfiguredAnnotationKey: "true",
+	}
+	writePodAnnotations(t, expected)
+	annotations, err := readPodAnnotations()
+	if err != nil || !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("Mismatch in expected (%v) vs actual (%v) annotations, error: %v", expected, annotations, err)
+	}
+	containers, err := readCPUAnnotation()
+	if err != nil || len(containers) != 1 || containers[0].Processes[0].Args[1] != `sleep "1"` {
+		t.Errorf("Cpu annotation was not read from the annotations, got: %+v, error: %v", containers, err)
+	}
+}
+
+func TestGetProvisionedCpuset(t *testing.T) {
+	var tcs = []struct {
+		name                string
+		annotations         map[string]string
+		cgroupCpuset        string
+		expectedProvisioned bool
+		expectedCpuset      string
+	}{
+		{
+			name:         "not_provisioned",
+			annotations:  map[string]string{},
+			cgroupCpuset: "0-7",
+		},
+		{
+			name:                "configured_marker",
+			annotations:         map[string]string{types.CpusetsConfiguredAnnotationKey: "true"},
+			cgroupCpuset:        "2-3",
+			expectedProvisioned: true,
+			expectedCpuset:      "2-3",
+		},
+		{
+			name:                "applied_cpuset",
+			annotations:         map[string]string{types.CpusetAnnotationKey: appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "cputestcontainer", Cpuset: "2-3,18-19"})},
+			cgroupCpuset:        "2-3,18-19",
+			expectedProvisioned: true,
+			expectedCpuset:      "2-3,18-19",
+		},
+		{
+			name: "applied_cpuset_of_restarted_container",
+			annotations: map[string]string{
+				types.CpusetAnnotationKey:            appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "cputestcontainer", Cpuset: "2-3"}),
+				types.CpusetsConfiguredAnnotationKey: "true",
+			},
+			cgroupCpuset: "0-7",
+		},
+		{
+			name:                "empty_applied_cpuset",
+			annotations:         map[string]string{types.CpusetAnnotationKey: appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "cputestcontainer"})},
+			cgroupCpuset:        "0-7",
+			expectedProvisioned: true,
+			expectedCpuset:      "0-7",
+		},
+		{
+			name:         "applied_cpuset_of_other_container",
+			annotations:  map[string]string{types.CpusetAnnotationKey: appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "sidecar", Cpuset: "0-1"})},
+			cgroupCpuset: "0-1",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			provisionedCpuset, isProvisioned := getProvisionedCpuset(tc.annotations, "cputestcontainer", cpuset.MustParse(tc.cgroupCpuset))
+			if isProvisioned != tc.expectedProvisioned || provisionedCpuset.String() != tc.expectedCpuset {
+				t.Errorf("Mismatch in expected (%v, %s) vs actual (%v, %s) provisioned cpuset", tc.expectedProvisioned, tc.expectedCpuset, isProvisioned, provisionedCpuset)
+			}
+		})
+	}
+}
+
+func TestSplitProvisionedCpuset(t *testing.T) {
+	var tcs = []struct {
+		poolType          string
+		sharedCPUs        string
+		expectedExclusive []int
+		expectedShared    []int
+	}{
+		{poolType: types.ExclusivePoolID + "&" + types.SharedPoolID, sharedCPUs: "0,1", expectedExclusive: []int{2, 3, 18, 19}, expectedShared: []int{0, 1}},
+		{poolType: types.ExclusivePoolID, expectedExclusive: []int{0, 1, 2, 3, 18, 19}},
+		{poolType: types.SharedPoolID, sharedCPUs: "0,1", expectedShared: []int{0, 1, 2, 3, 18, 19}},
+		{poolType: types.DefaultPoolID, expectedShared: []int{0, 1, 2, 3, 18, 19}},
+	}
+	for _, tc := range tcs {
+		exclusiveCPUs, sharedCPUs := splitProvisionedCpuset(cpuset.MustParse("0-3,18-19"), tc.poolType, tc.sharedCPUs)
+		if len(exclusiveCPUs)+len(tc.expectedExclusive) > 0 && !reflect.DeepEqual(exclusiveCPUs, tc.expectedExclusive) {
+			t.Errorf("Mismatch in expected (%v) vs actual (%v) exclusive CPUs of pool type %s", tc.expectedExclusive, exclusiveCPUs, tc.poolType)
+		}
+		if len(sharedCPUs)+len(tc.expectedShared) > 0 && !reflect.DeepEqual(sharedCPUs, tc.expectedShared) {
+			t.Errorf("Mismatch in expected (%v) vs actual (%v) shared CPUs of pool type %s", tc.expectedShared, sharedCPUs, tc.poolType)
+		}
+	}
+}
+
+func TestWaitForProvisionedCpuset(t *testing.T) {
+	originalAnnotationsFile, originalProcSelfCgroup, originalCgroupRoot := podAnnotationsFile, procSelfCgroup, cgroupRoot
+	defer func() {
+		podAnnotationsFile, procSelfCgroup, cgroupRoot = originalAnnotationsFile, originalProcSelfCgroup, originalCgroupRoot
+	}()
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "podinfo"), 0755)
+	podAnnotationsFile = filepath.Join(tempDir, "podinfo", "annotations")
+	procSelfCgroup = filepath.Join(tempDir, "cgroup")
+	cgroupRoot = tempDir
+	if err := ioutil.WriteFile(procSelfCgroup, []byte("0::/\n"), 0644); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(cgroupRoot, "cpuset.cpus.effective"), []byte("2-3\n"), 0644); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	writePodAnnotations(t, map[string]string{})
+	annotation := types.CpusetAnnotationKey + "=" + strconv.Quote(appliedCpusetsAnnotation(t, types.ContainerCpuset{Name: "cputestcontainer", Cpuset: "2-3"}))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ioutil.WriteFile(podAnnotationsFile, []byte(annotation), 0644)
+	}()
+	provisionedCpuset := waitForProvisionedCpuset("cputestcontainer")
+	if provisionedCpuset.String() != "2-3" {
+		t.Errorf("Mismatch in expected (2-3) vs actual (%s) provisioned cpuset", provisionedCpuset)
+	}
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
-	"reflect"
+	"runtime"
 	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/sys/unix"
 )
 
-func TestSetAffinity(t *testing.T) {
-	cpuList := []int{2, 3, 4, 5}
-	cpuList = setAffinity(2, cpuList)
-	if !reflect.DeepEqual(cpuList, []int{4, 5}) {
-		t.Errorf("Cpulist error %v:%v", cpuList, []int{4, 5})
-	}
-	cpuList = setAffinity(2, cpuList)
-	if !reflect.DeepEqual(cpuList, []int{}) {
-		t.Errorf("Cpulist error %v:%v", cpuList, []int{})
-	}
-	cpuList = setAffinity(2, cpuList)
-	if cpuList != nil {
-		t.Errorf("Cpulist error %v", cpuList)
-	}
+func TestApplyProcessAttributes(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		//The thread is thrown away together with its attributes when the goroutine exits
+		runtime.LockOSThread()
+		err := applyProcessAttributes(types.Process{ProcName: "proc1", Nice: 5}, []int{0})
+		if err != nil {
+			t.Errorf("Process attributes could not be applied: %s", err.Error())
+			return
+		}
+		var mask unix.CPUSet
+		if err = unix.SchedGetaffinity(0, &mask); err != nil || mask.Count() != 1 || !mask.IsSet(0) {
+			t.Errorf("Affinity was not set to CPU 0, error: %v", err)
+		}
+		attr, err := unix.SchedGetAttr(0, 0)
+		if err != nil || attr.Policy != unix.SCHED_NORMAL || attr.Nice != 5 {
+			t.Errorf("Scheduling attributes were not set, expected policy: %d nice: 5, actual: %+v, error: %v", unix.SCHED_NORMAL, attr, err)
+		}
+	}()
+	<-done
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"unsafe"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+var schedPolicies = map[string]uint32{
+	"":                     unix.SCHED_NORMAL,
+	types.SchedPolicyOther: unix.SCHED_NORMAL,
+	types.SchedPolicyFIFO:  unix.SCHED_FIFO,
+	types.SchedPolicyRR:    unix.SCHED_RR,
+	types.SchedPolicyBatch: unix.SCHED_BATCH,
+	types.SchedPolicyIdle:  unix.SCHED_IDLE,
+}
+
+//applyProcessAttributes sets the CPU affinity, the scheduling policy and the nice value of a process on the calling thread.
+//All of them are inherited by the processes forked or executed from the thread
+func applyProcessAttributes(process types.Process, cpus []int) error {
+	if len(cpus) > 0 {
+		var mask unix.CPUSet
+		for _, cpu := range cpus {
+			mask.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &mask); err != nil {
+			return fmt.Errorf("cannot set affinity %v for process %s: %v", cpus, process.ProcName, err)
+		}
+	}
+	if process.SchedPolicy == "" && process.Nice == 0 {
+		return nil
+	}
+	policy, exists := schedPolicies[process.SchedPolicy]
+	if !exists {
+		return fmt.Errorf("unknown scheduling policy %s for process %s", process.SchedPolicy, process.ProcName)
+	}
+	attr := unix.SchedAttr{
+		Size:     uint32(unsafe.Sizeof(unix.SchedAttr{})),
+		Policy:   policy,
+		Priority: uint32(process.Priority),
+		Nice:     int32(process.Nice),
+	}
+	err := unix.SchedSetAttr(0, &attr, 0)
+	if errors.Is(err, unix.EPERM) {
+		return fmt.Errorf("cannot set scheduling policy %s with priority %d and nice %d for process %s: %v. "+
+			"The container needs the CAP_SYS_NICE capability for real-time policies and negative nice values",
+			schedPolicyName(process.SchedPolicy), process.Priority, process.Nice, process.ProcName, err)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot set scheduling policy %s with priority %d and nice %d for process %s: %v",
+			schedPolicyName(process.SchedPolicy), process.Priority, process.Nice, process.ProcName, err)
+	}
+	return nil
+}
+
+//startProcess starts a process with its attributes from a dedicated thread. The thread is thrown away afterwards
+//so the attributes of a process never leak to the next one, nor to process-starter
+func startProcess(process types.Process, cpus []int) (int, error) {
+	path, err := exec.LookPath(process.ProcName)
+	if err != nil {
+		return 0, err
+	}
+	type startResult struct {
+		pid int
+		err error
+	}
+	result := make(chan startResult)
+	go func() {
+		//The goroutine exits without unlocking, which terminates its thread
+		runtime.LockOSThread()
+		if err := applyProcessAttributes(process, cpus); err != nil {
+			result <- startResult{err: err}
+			return
+		}
+		proc, err := os.StartProcess(path, append([]string{process.ProcName}, process.Args...), &os.ProcAttr{
+			Env:   os.Environ(),
+			Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		})
+		if err != nil {
+			result <- startResult{err: err}
+			return
+		}
+		pid := proc.Pid
+		//The supervisor reaps every child itself, otherwise the last process inherits them through exec
+		proc.Release()
+		result <- startResult{pid: pid}
+	}()
+	res := <-result
+	return res.pid, res.err
+}
+
+func schedPolicyName(policy string) string {
+	if policy == "" {
+		return types.SchedPolicyOther
+	}
+	return policy
+}
+
+//pinSupervisor sets the affinity of every thread of process-starter to the provided CPUs.
+//Threads created later by the Go runtime inherit it, so only the threads starting processes ever leave these CPUs
+func pinSupervisor(cpus []int) {
+	if len(cpus) == 0 {
+		fmt.Printf("No CPU is left for the supervisor next to the exclusive processes, keeping the cpuset of the container\n")
+		return
+	}
+	tasks, err := ioutil.ReadDir(filepath.Join(procRoot, "self", "task"))
+	if err != nil {
+		fmt.Printf("Cannot list threads of the supervisor: %v\n", err)
+		return
+	}
+	var mask unix.CPUSet
+	for _, cpu := range cpus {
+		mask.Set(cpu)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err = unix.SchedSetaffinity(tid, &mask); err != nil {
+			fmt.Printf("Cannot set affinity %v of supervisor thread %d: %v\n", cpus, tid, err)
+		}
+	}
+	fmt.Printf("Supervisor pinned to %v\n", cpus)
+}
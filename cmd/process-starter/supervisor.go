@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	//restartBackoffMin and restartBackoffMax bound the delay between two restarts of a process
+	restartBackoffMin = 1 * time.Second
+	restartBackoffMax = 30 * time.Second
+	//stableRunTime is how long a process has to run before its restart delay is reset
+	stableRunTime = 10 * time.Second
+	//terminationGracePeriod is how long the remaining processes are given to exit after a critical process exited
+	terminationGracePeriod = 10 * time.Second
+	//forwardedSignals are relayed to all running processes. SIGTERM and SIGINT also stop the supervision
+	forwardedSignals = []os.Signal{unix.SIGTERM, unix.SIGINT, unix.SIGHUP, unix.SIGQUIT, unix.SIGUSR1, unix.SIGUSR2}
+)
+
+type supervisedProcess struct {
+	process               types.Process
+	cpus                  processCPUs
+	pinnedThreads         map[int]bool
+	unmatchedThreads      map[int]bool
+	threadRecheckInterval time.Duration
+	nextThreadRecheck     time.Time
+	threadCounts          []int
+	pid                   int
+	running               bool
+	pendingRestart        bool
+	startTime             time.Time
+	backoff               time.Duration
+}
+
+//supervisor stays as the init process of the container. It starts the annotated processes, forwards the signals
+//of the container to them, reaps all zombies, and restarts the processes according to their restart policy
+type supervisor struct {
+	processes []*supervisedProcess
+	//cpus is where the supervisor itself runs once the processes are started
+	cpus     []int
+	restarts chan *supervisedProcess
+	stopping bool
+	exitCode int
+	deadline <-chan time.Time
+}
+
+func newSupervisor(processes []types.Process, cpus []processCPUs, supervisorCPUs []int) *supervisor {
+	s := &supervisor{restarts: make(chan *supervisedProcess, len(processes)), cpus: supervisorCPUs}
+	for index, process := range processes {
+		s.processes = append(s.processes, &supervisedProcess{process: process, cpus: cpus[index], backoff: restartBackoffMin})
+	}
+	return s
+}
+
+//processCPUs are the CPUs of a process, and of its pinned threads in the order of the thread patterns of the process
+type processCPUs struct {
+	cpus    []int
+	threads [][]int
+}
+
+//assignCPUs returns the CPUs of every process and pinned thread: the next free exclusive CPUs for the ones using exclusive pools,
+//and all the shared CPUs for the rest
+func assignCPUs(processes []types.Process, exclCPUs, sharedCPUs []int) ([]processCPUs, error) {
+	assign := func(name string, nbrCPUs int, poolName string) ([]int, error) {
+		if !strings.HasPrefix(poolName, "exclusive") {
+			return sharedCPUs, nil
+		}
+		if len(exclCPUs) < nbrCPUs {
+			return nil, fmt.Errorf("not enough exclusive cpus free for %s, %d requested from %v", name, nbrCPUs, exclCPUs)
+		}
+		cpus := exclCPUs[:nbrCPUs]
+		exclCPUs = exclCPUs[nbrCPUs:]
+		return cpus, nil
+	}
+	assigned := make([]processCPUs, 0, len(processes))
+	for _, process := range processes {
+		cpus, err := assign("process "+process.ProcName, process.CPUs, process.PoolName)
+		if err != nil {
+			return nil, err
+		}
+		processCPUs := processCPUs{cpus: cpus}
+		for _, thread := range process.Threads {
+			threadCPUs, err := assign("threads "+thread.Name+" of process "+process.ProcName, thread.CPUs, thread.PoolName)
+			if err != nil {
+				return nil, err
+			}
+			processCPUs.threads = append(processCPUs.threads, threadCPUs)
+		}
+		assigned = append(assigned, processCPUs)
+	}
+	return assigned, nil
+}
+
+//getSupervisorCPUs returns the shared CPUs of the container, or its default cpuset when it has none:
+//the CPUs of the container not assigned to any process or thread using an exclusive pool
+func getSupervisorCPUs(exclCPUs, sharedCPUs []int, assigned []processCPUs) []int {
+	if len(sharedCPUs) > 0 {
+		return sharedCPUs
+	}
+	used := map[int]bool{}
+	for _, processCPUs := range assigned {
+		for _, cpu := range processCPUs.cpus {
+			used[cpu] = true
+		}
+		for _, threadCPUs := range processCPUs.threads {
+			for _, cpu := range threadCPUs {
+				used[cpu] = true
+			}
+		}
+	}
+	cpus := []int{}
+	for _, cpu := range exclCPUs {
+		if !used[cpu] {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus
+}
+
+//run starts all processes, and supervises them until the container is stopped, a critical process exits,
+//or none of the processes is left running. Returns the exit code of the container
+func (s *supervisor) run() int {
+	signals := make(chan os.Signal, 32)
+	signal.Notify(signals, append(forwardedSignals, unix.SIGCHLD)...)
+	defer signal.Stop(signals)
+	for _, p := range s.processes {
+		if s.stopping {
+			break
+		}
+		s.start(p)
+	}
+	//The supervisor keeps running next to the processes, it must not steal cycles from the ones using exclusive CPUs
+	pinSupervisor(s.cpus)
+	//Threads are only pinned when any of the processes asks for it
+	var threadScan <-chan time.Time
+	for _, p := range s.processes {
+		if len(p.process.Threads) > 0 {
+			ticker := time.NewTicker(threadScanInterval)
+			defer ticker.Stop()
+			threadScan = ticker.C
+			break
+		}
+	}
+	for {
+		if s.isFinished() {
+			return s.exitCode
+		}
+		select {
+		case sig := <-signals:
+			if sig == unix.SIGCHLD {
+				s.reap()
+				continue
+			}
+			fmt.Printf("Forwarding signal %v to supervised processes\n", sig)
+			s.signalAll(sig.(unix.Signal))
+			if sig == unix.SIGTERM || sig == unix.SIGINT {
+				s.stopping = true
+			}
+		case p := <-s.restarts:
+			p.pendingRestart = false
+			if !s.stopping {
+				s.start(p)
+			}
+		case <-threadScan:
+			for _, p := range s.processes {
+				if p.running {
+					pinThreads(p)
+				}
+			}
+		case <-s.deadline:
+			fmt.Printf("Processes did not exit in %v, killing them\n", terminationGracePeriod)
+			s.signalAll(unix.SIGKILL)
+			return s.exitCode
+		}
+	}
+}
+
+func (s *supervisor) isFinished() bool {
+	for _, p := range s.processes {
+		if p.running || (p.pendingRestart && !s.stopping) {
+			return false
+		}
+	}
+	return true
+}
+
+//start starts the process with the affinity of its CPUs, and its scheduling attributes
+func (s *supervisor) start(p *supervisedProcess) {
+	fmt.Printf("Starting process %s %v\n", p.process.ProcName, p.process.Args)
+	pid, err := startProcess(p.process, p.cpus.cpus)
+	if err != nil {
+		fmt.Printf("Failed starting %s: %v\n", p.process.ProcName, err)
+		p.startTime = time.Now()
+		s.handleExit(p, 127)
+		return
+	}
+	p.pid = pid
+	p.running = true
+	p.startTime = time.Now()
+	p.pinnedThreads = map[int]bool{}
+	p.unmatchedThreads = map[int]bool{}
+	p.threadRecheckInterval = threadScanInterval
+	p.nextThreadRecheck = time.Time{}
+	p.threadCounts = make([]int, len(p.process.Threads))
+}
+
+//reap collects the exit status of every exited child, including the orphans re-parented to the supervisor
+func (s *supervisor) reap() {
+	for {
+		var status unix.WaitStatus
+		pid, err := unix.Wait4(-1, &status, unix.WNOHANG, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return
+		}
+		for _, p := range s.processes {
+			if p.running && p.pid == pid {
+				s.handleExit(p, exitStatus(status))
+			}
+		}
+	}
+}
+
+func (s *supervisor) handleExit(p *supervisedProcess, status int) {
+	p.running = false
+	fmt.Printf("Process %s (pid %d) exited with status %d\n", p.process.ProcName, p.pid, status)
+	if s.stopping {
+		return
+	}
+	if shouldRestart(p.process.RestartPolicy, status) {
+		s.scheduleRestart(p)
+		return
+	}
+	s.exitCode = status
+	if p.process.Critical {
+		fmt.Printf("Critical process %s exited, stopping container\n", p.process.ProcName)
+		s.stopping = true
+		s.signalAll(unix.SIGTERM)
+		s.deadline = time.After(terminationGracePeriod)
+	}
+}
+
+func (s *supervisor) scheduleRestart(p *supervisedProcess) {
+	if time.Since(p.startTime) >= stableRunTime {
+		p.backoff = restartBackoffMin
+	}
+	delay := p.backoff
+	p.backoff *= 2
+	if p.backoff > restartBackoffMax {
+		p.backoff = restartBackoffMax
+	}
+	fmt.Printf("Restarting process %s in %v\n", p.process.ProcName, delay)
+	p.pendingRestart = true
+	time.AfterFunc(delay, func() { s.restarts <- p })
+}
+
+func (s *supervisor) signalAll(sig unix.Signal) {
+	for _, p := range s.processes {
+		if p.running {
+			unix.Kill(p.pid, sig)
+		}
+	}
+}
+
+func shouldRestart(policy string, status int) bool {
+	switch policy {
+	case types.RestartPolicyAlways:
+		return true
+	case types.RestartPolicyOnFailure:
+		return status != 0
+	}
+	return false
+}
+
+//exitStatus returns the exit code of a process the same way shells do, i.e. 128+signal for killed processes
+func exitStatus(status unix.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
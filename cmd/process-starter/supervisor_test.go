@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+func TestAssignCPUs(t *testing.T) {
+	processes := []types.Process{
+		{ProcName: "proc1", CPUs: 2, PoolName: "exclusive_caas", Threads: []types.Thread{
+			{Name: "lcore-worker-*", CPUs: 2, PoolName: "exclusive_caas"},
+			{Name: "eal-intr-*", CPUs: 100, PoolName: "shared_caas"},
+		}},
+		{ProcName: "proc2", CPUs: 100, PoolName: "shared_caas"},
+		{ProcName: "proc3", CPUs: 1, PoolName: "exclusive_caas"},
+	}
+	cpus, err := assignCPUs(processes, []int{2, 3, 4, 5, 6}, []int{0, 1})
+	if err != nil {
+		t.Fatalf("CPUs could not be assigned: %s", err.Error())
+	}
+	expected := []processCPUs{
+		{cpus: []int{2, 3}, threads: [][]int{{4, 5}, {0, 1}}},
+		{cpus: []int{0, 1}},
+		{cpus: []int{6}},
+	}
+	if !reflect.DeepEqual(cpus, expected) {
+		t.Errorf("Mismatch in expected (%v) vs actual (%v) assigned CPUs", expected, cpus)
+	}
+	if _, err = assignCPUs(processes, []int{2, 3, 4, 5}, []int{0, 1}); err == nil {
+		t.Errorf("More exclusive CPUs were assigned than allocated")
+	}
+}
+
+func TestGetSupervisorCPUs(t *testing.T) {
+	assigned := []processCPUs{
+		{cpus: []int{2, 3}, threads: [][]int{{4}}},
+		{cpus: []int{5}},
+	}
+	if cpus := getSupervisorCPUs([]int{2, 3, 4, 5, 6, 7}, []int{0, 1}, assigned); !reflect.DeepEqual(cpus, []int{0, 1}) {
+		t.Errorf("Supervisor should run on the shared CPUs, got: %v", cpus)
+	}
+	if cpus := getSupervisorCPUs([]int{2, 3, 4, 5, 6, 7}, nil, assigned); !reflect.DeepEqual(cpus, []int{6, 7}) {
+		t.Errorf("Supervisor should run on the CPUs not assigned to any exclusive process or thread, got: %v", cpus)
+	}
+	if cpus := getSupervisorCPUs([]int{2, 3, 4, 5}, nil, assigned); len(cpus) != 0 {
+		t.Errorf("Supervisor should not be pinned when every CPU is used exclusively, got: %v", cpus)
+	}
+}
+
+func TestPinSupervisor(t *testing.T) {
+	var original unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &original); err != nil {
+		t.Fatalf("Affinity of the test could not be read: %v", err)
+	}
+	var originalCPUs []int
+	for cpu := 0; cpu < len(original)*64; cpu++ {
+		if original.IsSet(cpu) {
+			originalCPUs = append(originalCPUs, cpu)
+		}
+	}
+	defer pinSupervisor(originalCPUs)
+	pinSupervisor(originalCPUs[:1])
+	tasks, _ := ioutil.ReadDir("/proc/self/task")
+	for _, task := range tasks {
+		tid, _ := strconv.Atoi(task.Name())
+		var mask unix.CPUSet
+		if err := unix.SchedGetaffinity(tid, &mask); err != nil {
+			continue
+		}
+		if mask.Count() != 1 || !mask.IsSet(originalCPUs[0]) {
+			t.Errorf("Thread %d of the supervisor was not pinned to CPU %d", tid, originalCPUs[0])
+		}
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	var tcs = []struct {
+		policy   string
+		status   int
+		expected bool
+	}{
+		{policy: "", status: 1, expected: false},
+		{policy: types.RestartPolicyNever, status: 1, expected: false},
+		{policy: types.RestartPolicyOnFailure, status: 0, expected: false},
+		{policy: types.RestartPolicyOnFailure, status: 137, expected: true},
+		{policy: types.RestartPolicyAlways, status: 0, expected: true},
+	}
+	for _, tc := range tcs {
+		if shouldRestart(tc.policy, tc.status) != tc.expected {
+			t.Errorf("Restart decision of policy: %s for status: %d should be: %v", tc.policy, tc.status, tc.expected)
+		}
+	}
+}
+
+func TestSupervisorExitsWithCriticalStatus(t *testing.T) {
+	processes := []types.Process{
+		{ProcName: "/bin/sh", Args: []string{"-c", "exec sleep 30"}},
+		{ProcName: "/bin/sh", Args: []string{"-c", "sleep 0.2; exit 3"}, Critical: true},
+	}
+	start := time.Now()
+	exitCode := newSupervisor(processes, make([]processCPUs, len(processes)), nil).run()
+	if exitCode != 3 {
+		t.Errorf("Supervisor should exit with the status of the critical process, got: %d", exitCode)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Remaining processes were not terminated after the critical process exited")
+	}
+}
+
+func TestSupervisorRestartsFailedProcess(t *testing.T) {
+	originalBackoff := restartBackoffMin
+	restartBackoffMin = 10 * time.Millisecond
+	defer func() { restartBackoffMin = originalBackoff }()
+	runLog := filepath.Join(t.TempDir(), "runs")
+	//The process fails on its first two runs
+	script := "echo run >> " + runLog + "; [ $(wc -l < " + runLog + ") -ge 3 ] || exit 1"
+	processes := []types.Process{
+		{ProcName: "/bin/sh", Args: []string{"-c", script}, RestartPolicy: types.RestartPolicyOnFailure, Critical: true},
+	}
+	exitCode := newSupervisor(processes, make([]processCPUs, len(processes)), nil).run()
+	if exitCode != 0 {
+		t.Errorf("Supervisor should exit with the status of the succeeded process, got: %d", exitCode)
+	}
+	runs, err := ioutil.ReadFile(runLog)
+	if err != nil || strings.Count(string(runs), "run") != 3 {
+		t.Errorf("Failed process should have been restarted until it succeeded, runs: %q, error: %v", string(runs), err)
+	}
+}
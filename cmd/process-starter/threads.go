@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	procRoot = "/proc"
+	//threadScanInterval is how often the threads of the supervised processes are looked up
+	threadScanInterval = 100 * time.Millisecond
+	//threadRecheckMaxInterval bounds how rarely the names of the threads not matching any pattern are read again
+	threadRecheckMaxInterval = 10 * time.Second
+)
+
+//pinThreads sets the affinity of the new threads of a process whose name matches one of its thread patterns.
+//Threads matching an exclusive pattern get one CPU each, assigned round-robin, others get all the CPUs of their pattern.
+//Threads not matching any pattern keep the affinity of the process. They are checked again as they may be renamed later,
+//but less and less often while the process does not start new threads
+func pinThreads(p *supervisedProcess) {
+	tasks, err := ioutil.ReadDir(filepath.Join(procRoot, strconv.Itoa(p.pid), "task"))
+	if err != nil {
+		fmt.Printf("Cannot list threads of process %s (pid %d): %v\n", p.process.ProcName, p.pid, err)
+		return
+	}
+	now := time.Now()
+	recheck := !now.Before(p.nextThreadRecheck)
+	newThreads := false
+	existingThreads := map[int]bool{}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		existingThreads[tid] = true
+		if p.pinnedThreads[tid] || (p.unmatchedThreads[tid] && !recheck) {
+			continue
+		}
+		if !p.unmatchedThreads[tid] {
+			newThreads = true
+		}
+		comm, err := ioutil.ReadFile(filepath.Join(procRoot, strconv.Itoa(p.pid), "task", task.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		threadName := strings.TrimSpace(string(comm))
+		p.unmatchedThreads[tid] = true
+		for index, thread := range p.process.Threads {
+			if match, _ := filepath.Match(thread.Name, threadName); !match {
+				continue
+			}
+			cpus := p.cpus.threads[index]
+			if strings.HasPrefix(thread.PoolName, "exclusive") {
+				cpus = []int{cpus[p.threadCounts[index]%len(cpus)]}
+				p.threadCounts[index]++
+			}
+			var mask unix.CPUSet
+			for _, cpu := range cpus {
+				mask.Set(cpu)
+			}
+			if err = unix.SchedSetaffinity(tid, &mask); err != nil {
+				fmt.Printf("Cannot set affinity of thread %s (tid %d) of process %s: %v\n", threadName, tid, p.process.ProcName, err)
+			} else {
+				fmt.Printf("Thread %s (tid %d) of process %s pinned to %v\n", threadName, tid, p.process.ProcName, cpus)
+			}
+			p.pinnedThreads[tid] = true
+			delete(p.unmatchedThreads, tid)
+			break
+		}
+	}
+	for tid := range p.pinnedThreads {
+		if !existingThreads[tid] {
+			delete(p.pinnedThreads, tid)
+		}
+	}
+	for tid := range p.unmatchedThreads {
+		if !existingThreads[tid] {
+			delete(p.unmatchedThreads, tid)
+		}
+	}
+	//New threads are usually named right after they are created, so the unmatched ones are checked again soon
+	if newThreads {
+		p.threadRecheckInterval = threadScanInterval
+	} else if recheck {
+		p.threadRecheckInterval *= 2
+		if p.threadRecheckInterval > threadRecheckMaxInterval {
+			p.threadRecheckInterval = threadRecheckMaxInterval
+		}
+	}
+	if newThreads || recheck {
+		p.nextThreadRecheck = now.Add(p.threadRecheckInterval)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"golang.org/x/sys/unix"
+)
+
+//addThread fakes a thread of a process under procRoot
+func addThread(t *testing.T, pid, tid int, name string) {
+	taskDir := filepath.Join(procRoot, strconv.Itoa(pid), "task", strconv.Itoa(tid))
+	os.MkdirAll(taskDir, 0755)
+	if err := ioutil.WriteFile(filepath.Join(taskDir, "comm"), []byte(name+"\n"), 0644); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+}
+
+func TestPinThreads(t *testing.T) {
+	originalProcRoot := procRoot
+	defer func() { procRoot = originalProcRoot }()
+	procRoot = t.TempDir()
+	tids := make(chan int)
+	release := make(chan struct{})
+	//The affinity of a real thread is set, which is thrown away when the goroutine exits
+	go func() {
+		runtime.LockOSThread()
+		tids <- unix.Gettid()
+		<-release
+	}()
+	tid := <-tids
+	defer close(release)
+	pid := os.Getpid()
+	//The main thread of the faked process is not a real thread, so its affinity is never changed even if it is pinned
+	mainTid := 1 << 22
+	addThread(t, pid, mainTid, "proc1")
+	addThread(t, pid, tid, "lcore-worker-1")
+	p := &supervisedProcess{
+		process: types.Process{ProcName: "proc1", Threads: []types.Thread{
+			{Name: "lcore-worker-*", CPUs: 1, PoolName: "exclusive_caas"},
+		}},
+		cpus:                  processCPUs{cpus: []int{0}, threads: [][]int{{0}}},
+		pinnedThreads:         map[int]bool{},
+		unmatchedThreads:      map[int]bool{},
+		threadRecheckInterval: threadScanInterval,
+		threadCounts:          []int{0},
+		pid:                   pid,
+	}
+	pinThreads(p)
+	var mask unix.CPUSet
+	if err := unix.SchedGetaffinity(tid, &mask); err != nil || mask.Count() != 1 || !mask.IsSet(0) {
+		t.Errorf("Affinity of the matching thread was not set to CPU 0, error: %v", err)
+	}
+	if !p.pinnedThreads[tid] || p.pinnedThreads[mainTid] || !p.unmatchedThreads[mainTid] {
+		t.Errorf("Only the matching thread should be pinned, pinned threads: %v, unmatched threads: %v", p.pinnedThreads, p.unmatchedThreads)
+	}
+	//Renamed threads are only noticed when the unmatched threads are checked again
+	addThread(t, pid, mainTid, "lcore-worker-0")
+	pinThreads(p)
+	if p.pinnedThreads[mainTid] {
+		t.Errorf("Names of unmatched threads should not be read again on every scan")
+	}
+	p.nextThreadRecheck = time.Now()
+	pinThreads(p)
+	if !p.pinnedThreads[mainTid] || p.unmatchedThreads[mainTid] {
+		t.Errorf("Renamed thread should be pinned once its recheck is due, pinned threads: %v", p.pinnedThreads)
+	}
+	if p.threadRecheckInterval != 2*threadScanInterval {
+		t.Errorf("Recheck interval should back off while no new threads appear, got: %v", p.threadRecheckInterval)
+	}
+	os.RemoveAll(filepath.Join(procRoot, strconv.Itoa(pid), "task", strconv.Itoa(tid)))
+	os.RemoveAll(filepath.Join(procRoot, strconv.Itoa(pid), "task", strconv.Itoa(mainTid)))
+	pinThreads(p)
+	if len(p.pinnedThreads) != 0 {
+		t.Errorf("Exited threads should be forgotten, pinned threads: %v", p.pinnedThreads)
+	}
+}
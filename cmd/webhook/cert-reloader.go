@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+var (
+	//certReloadDelay gives the writer of the certificate files (e.g. kubelet updating a Secret volume) time to finish replacing both of them before the keypair is reloaded
+	certReloadDelay = 2 * time.Second
+)
+
+//certificateReloader serves the most recently loaded TLS keypair to every new TLS handshake
+//Connections established with the previous keypair are not affected by a reload, so certificate rotations do not drop them
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	certificate atomic.Value
+}
+
+func newCertificateReloader(certFile string, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+//reload re-reads the keypair from the files, and only replaces the served one if the new pair could be loaded
+func (reloader *certificateReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.certificate.Store(&cert)
+	return nil
+}
+
+//GetCertificate implements the GetCertificate callback of tls.Config
+func (reloader *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return reloader.certificate.Load().(*tls.Certificate), nil
+}
+
+//watch starts watching the directories of the certificate files, and reloads the keypair whenever any file changes in them
+//Directories are watched instead of the files themselves, because Secret volumes are updated by atomically swapping a symlink
+func (reloader *certificateReloader) watch(stopCh <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, dir := range []string{filepath.Dir(reloader.certFile), filepath.Dir(reloader.keyFile)} {
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	go reloader.handleEvents(watcher, stopCh)
+	return nil
+}
+
+func (reloader *certificateReloader) handleEvents(watcher *fsnotify.Watcher, stopCh <-chan struct{}) {
+	defer watcher.Close()
+	var certReload <-chan time.Time
+	for {
+		select {
+		case <-watcher.Events:
+			certReload = time.After(certReloadDelay)
+		case <-certReload:
+			certReload = nil
+			if err := reloader.reload(); err != nil {
+				glog.Errorf("Could not reload TLS keypair from %s and %s, keeping the active one: %v", reloader.certFile, reloader.keyFile, err)
+				continue
+			}
+			glog.Infof("TLS keypair reloaded from %s and %s", reloader.certFile, reloader.keyFile)
+		case err := <-watcher.Errors:
+			glog.Warningf("Error while watching TLS certificate files: %v", err)
+		case <-stopCh:
+			return
+		}
+	}
+}
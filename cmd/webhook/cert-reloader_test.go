@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeyPair(t *testing.T, certFile string, keyFile string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Key could not be generated: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Certificate could not be generated: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Key could not be marshalled: %v", err)
+	}
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600); err != nil {
+		t.Fatalf("Certificate could not be written: %v", err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Key could not be written: %v", err)
+	}
+}
+
+func servedCommonName(t *testing.T, reloader *certificateReloader) string {
+	cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("Certificate could not be served: %v", err)
+	}
+	parsedCert, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Served certificate could not be parsed: %v", err)
+	}
+	return parsedCert.Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+	certDir := t.TempDir()
+	certFile, keyFile := filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem")
+	writeKeyPair(t, certFile, keyFile, "original")
+	originalDelay := certReloadDelay
+	certReloadDelay = 10 * time.Millisecond
+	defer func() { certReloadDelay = originalDelay }()
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Certificate reloader could not be created: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err = reloader.watch(stopCh); err != nil {
+		t.Fatalf("Certificate files could not be watched: %v", err)
+	}
+	if commonName := servedCommonName(t, reloader); commonName != "original" {
+		t.Fatalf("Unexpected certificate served before rotation: %s", commonName)
+	}
+	if err = ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatalf("Key could not be corrupted: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if commonName := servedCommonName(t, reloader); commonName != "original" {
+		t.Errorf("Active certificate was replaced by an invalid keypair, served: %s", commonName)
+	}
+	writeKeyPair(t, certFile, keyFile, "rotated")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if servedCommonName(t, reloader) == "rotated" {
+			return
+		}
+	}
+	t.Errorf("Rotated certificate was not served, still serving: %s", servedCommonName(t, reloader))
+}
+
+func TestCertificateReloaderRequiresValidKeyPair(t *testing.T) {
+	certDir := t.TempDir()
+	if _, err := newCertificateReloader(filepath.Join(certDir, "cert.pem"), filepath.Join(certDir, "key.pem")); err == nil {
+		t.Errorf("Certificate reloader created without a keypair")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func serveValidatePod(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, validatePods)
+}
+
+//validatePods rejects Pods whose CPU pool requests could never be satisfied by any Node of the cluster
+func validatePods(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	glog.V(2).Info("validating pods")
+	podResource := metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	if ar.Request.Resource != podResource {
+		glog.Errorf("expect resource to be %s", podResource)
+		return nil
+	}
+
+	pod := corev1.Pod{}
+	deserializer := codecs.UniversalDeserializer()
+	if _, _, err := deserializer.Decode(ar.Request.Object.Raw, nil, &pod); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	//Pods not using CPU-Pooler are never blocked by a missing, or broken pool configuration
+	if !requestsPoolResources(&pod) {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	poolConfs, err := types.ReadAllPoolConfigs()
+	if err != nil {
+		glog.Errorf("Failed to read CPU pool configurations: %v", err)
+		return toAdmissionResponse(fmt.Errorf("CPU pool configurations could not be read: %v", err))
+	}
+	if err = validatePoolRequests(&pod, poolConfs); err != nil {
+		glog.Error(err)
+		return toAdmissionResponse(err)
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+//validatePoolRequests checks the pool requests of every container against the pool configurations of the cluster
+//All pools requested by a Pod must be configured together in at least one configuration file, i.e. on the same group of Nodes,
+// and the exclusive CPUs requested by all of its containers must fit into the exclusive pools of at least one of these groups
+func validatePoolRequests(pod *corev1.Pod, poolConfs []types.PoolConfig) error {
+	candidateConfs := make([]types.PoolConfig, len(poolConfs))
+	copy(candidateConfs, poolConfs)
+	requestedPools := []string{}
+	for _, container := range pod.Spec.Containers {
+		for _, resourceName := range getPoolResourceNames(container) {
+			poolName := strings.TrimPrefix(resourceName, resourceBaseName+"/")
+			request, limit := container.Resources.Requests[corev1.ResourceName(resourceName)], container.Resources.Limits[corev1.ResourceName(resourceName)]
+			if request.Cmp(limit) != 0 {
+				return fmt.Errorf("Container %s requests %s of resource %s, which differs from its limit %s", container.Name, request.String(), resourceName, limit.String())
+			}
+			if !isPoolConfigured(poolName, poolConfs) {
+				return fmt.Errorf("Container %s requests CPUs from pool %s, which does not exist in any CPU pool configuration", container.Name, poolName)
+			}
+			candidateConfs = filterConfsWithPool(candidateConfs, poolName)
+			if len(candidateConfs) == 0 {
+				return fmt.Errorf("Container %s requests CPUs from pool %s, which is not configured on the same Nodes as the other pools requested by the Pod: %s", container.Name, poolName, strings.Join(requestedPools, ", "))
+			}
+			requestedPools = append(requestedPools, poolName)
+		}
+	}
+	return validateExclusiveCapacity(pod, candidateConfs)
+}
+
+//validateExclusiveCapacity is only invoked once the group of Nodes the Pod can land on is fully narrowed down, as later containers can exclude groups earlier containers still fitted into
+func validateExclusiveCapacity(pod *corev1.Pod, candidateConfs []types.PoolConfig) error {
+	podExclusiveRequests := make(map[string]int64)
+	for _, container := range pod.Spec.Containers {
+		for _, resourceName := range getPoolResourceNames(container) {
+			poolName := strings.TrimPrefix(resourceName, resourceBaseName+"/")
+			if types.DeterminePoolType(poolName) != types.ExclusivePoolID {
+				continue
+			}
+			limit := container.Resources.Limits[corev1.ResourceName(resourceName)]
+			podExclusiveRequests[poolName] += limit.Value()
+			maxPoolSize := 0
+			for _, poolConf := range candidateConfs {
+				if poolSize := poolConf.Pools[poolName].CPUset.Size(); poolSize > maxPoolSize {
+					maxPoolSize = poolSize
+				}
+			}
+			if podExclusiveRequests[poolName] > int64(maxPoolSize) {
+				return fmt.Errorf("Container %s requests %d exclusive CPUs from pool %s, which brings the total request of the Pod to %d, but matching Nodes offer at most %d", container.Name, limit.Value(), poolName, podExclusiveRequests[poolName], maxPoolSize)
+			}
+		}
+	}
+	return nil
+}
+
+//getPoolResourceNames returns the CPU pool resources either requested, or limited by a container in a stable order, so rejections are reproducible
+func getPoolResourceNames(container corev1.Container) []string {
+	resourceNames := []string{}
+	for _, resourceList := range []corev1.ResourceList{container.Resources.Limits, container.Resources.Requests} {
+		for resourceName := range resourceList {
+			if strings.HasPrefix(string(resourceName), resourceBaseName+"/") && !containsString(resourceNames, string(resourceName)) {
+				resourceNames = append(resourceNames, string(resourceName))
+			}
+		}
+	}
+	sort.Strings(resourceNames)
+	return resourceNames
+}
+
+func requestsPoolResources(pod *corev1.Pod) bool {
+	for _, container := range pod.Spec.Containers {
+		if len(getPoolResourceNames(container)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, item string) bool {
+	for _, listItem := range list {
+		if listItem == item {
+			return true
+		}
+	}
+	return false
+}
+
+func isPoolConfigured(poolName string, poolConfs []types.PoolConfig) bool {
+	return len(filterConfsWithPool(poolConfs, poolName)) > 0
+}
+
+func filterConfsWithPool(poolConfs []types.PoolConfig, poolName string) []types.PoolConfig {
+	filteredConfs := []types.PoolConfig{}
+	for _, poolConf := range poolConfs {
+		if _, exists := poolConf.Pools[poolName]; exists {
+			filteredConfs = append(filteredConfs, poolConf)
+		}
+	}
+	return filteredConfs
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var validationPoolConfigs = map[string]string{
+	"poolconfig-controlplane.yaml": `
+nodeSelector:
+  nodename: controlplane
+pools:
+  default:
+    cpus: 0-1
+  exclusive_caas:
+    cpus: 2-5
+  shared_caas:
+    cpus: 6-7
+`,
+	"poolconfig-dataplane.yaml": `
+nodeSelector:
+  nodename: dataplane
+pools:
+  default:
+    cpus: 0-1
+  exclusive_caas:
+    cpus: 2-3
+  exclusive_dpdk:
+    cpus: 4-9
+  shared_dpdk:
+    cpus: 10-11
+`,
+}
+
+func setupPoolConfigDir(t *testing.T) {
+	configDir := t.TempDir()
+	for fileName, content := range validationPoolConfigs {
+		if err := ioutil.WriteFile(filepath.Join(configDir, fileName), []byte(content), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	originalDir := types.PoolConfigDir
+	types.PoolConfigDir = configDir
+	t.Cleanup(func() { types.PoolConfigDir = originalDir })
+}
+
+func poolContainer(name string, limits map[string]string) corev1.Container {
+	container := corev1.Container{Name: name, Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{}, Requests: corev1.ResourceList{}}}
+	for resourceName, value := range limits {
+		container.Resources.Limits[corev1.ResourceName(resourceBaseName+"/"+resourceName)] = resource.MustParse(value)
+		container.Resources.Requests[corev1.ResourceName(resourceBaseName+"/"+resourceName)] = resource.MustParse(value)
+	}
+	return container
+}
+
+func TestValidatePods(t *testing.T) {
+	setupPoolConfigDir(t)
+	mismatchingContainer := poolContainer("mismatch", map[string]string{"shared_caas": "200"})
+	mismatchingContainer.Resources.Requests[corev1.ResourceName(resourceBaseName+"/shared_caas")] = resource.MustParse("100")
+	var tcs = []struct {
+		name            string
+		containers      []corev1.Container
+		expectedAllowed bool
+		expectedError   string
+	}{
+		{"no_pool_requests", []corev1.Container{{Name: "plain"}}, true, ""},
+		{"valid_requests", []corev1.Container{poolContainer("mixed", map[string]string{"exclusive_caas": "2", "shared_caas": "100"})}, true, ""},
+		{"exclusive_fits_larger_group", []corev1.Container{poolContainer("big", map[string]string{"exclusive_caas": "4"})}, true, ""},
+		{"unknown_pool", []corev1.Container{poolContainer("plain", map[string]string{}), poolContainer("unknown", map[string]string{"exclusive_nonexisting": "1"})}, false, "Container unknown requests CPUs from pool exclusive_nonexisting"},
+		{"too_many_exclusive", []corev1.Container{poolContainer("greedy", map[string]string{"exclusive_caas": "5"})}, false, "Container greedy requests 5 exclusive CPUs from pool exclusive_caas"},
+		{"too_many_exclusive_in_pod", []corev1.Container{poolContainer("first", map[string]string{"exclusive_caas": "3"}), poolContainer("second", map[string]string{"exclusive_caas": "2"})}, false, "Container second requests 2 exclusive CPUs"},
+		{"group_narrowed_by_later_container", []corev1.Container{poolContainer("first", map[string]string{"exclusive_caas": "3"}), poolContainer("second", map[string]string{"shared_dpdk": "100"})}, false, "Container first requests 3 exclusive CPUs from pool exclusive_caas, which brings the total request of the Pod to 3, but matching Nodes offer at most 2"},
+		{"pools_of_different_groups", []corev1.Container{poolContainer("first", map[string]string{"shared_caas": "100"}), poolContainer("second", map[string]string{"exclusive_dpdk": "1"})}, false, "Container second requests CPUs from pool exclusive_dpdk, which is not configured on the same Nodes as the other pools requested by the Pod: shared_caas"},
+		{"request_differs_from_limit", []corev1.Container{mismatchingContainer}, false, "Container mismatch requests 100 of resource nokia.k8s.io/shared_caas, which differs from its limit 200"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := corev1.Pod{Spec: corev1.PodSpec{Containers: tc.containers}}
+			podJSON, err := json.Marshal(&pod)
+			if err != nil {
+				t.Fatalf("Pod could not be marshalled: %v", err)
+			}
+			review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{Resource: metav1.GroupVersionResource{Version: "v1", Resource: "pods"}}}
+			review.Request.Object.Raw = podJSON
+			response := validatePods(review)
+			if response.Allowed != tc.expectedAllowed {
+				t.Fatalf("Expected allowed: %t, got: %t, result: %v", tc.expectedAllowed, response.Allowed, response.Result)
+			}
+			if !tc.expectedAllowed && !strings.Contains(response.Result.Message, tc.expectedError) {
+				t.Errorf("Expected rejection message to contain: %s, got: %s", tc.expectedError, response.Result.Message)
+			}
+		})
+	}
+}
+
+func TestValidatePodsWithoutPoolConfigs(t *testing.T) {
+	originalDir := types.PoolConfigDir
+	types.PoolConfigDir = filepath.Join(t.TempDir(), "nonexisting")
+	defer func() { types.PoolConfigDir = originalDir }()
+	var tcs = []struct {
+		name            string
+		containers      []corev1.Container
+		expectedAllowed bool
+	}{
+		{"no_pool_requests", []corev1.Container{{Name: "plain"}}, true},
+		{"pool_requests", []corev1.Container{poolContainer("shared", map[string]string{"shared_caas": "100"})}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			podJSON, err := json.Marshal(&corev1.Pod{Spec: corev1.PodSpec{Containers: tc.containers}})
+			if err != nil {
+				t.Fatalf("Pod could not be marshalled: %v", err)
+			}
+			review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{Resource: metav1.GroupVersionResource{Version: "v1", Resource: "pods"}}}
+			review.Request.Object.Raw = podJSON
+			if response := validatePods(review); response.Allowed != tc.expectedAllowed {
+				t.Errorf("Expected allowed: %t, got: %t, result: %v", tc.expectedAllowed, response.Allowed, response.Result)
+			}
+		})
+	}
+}
+
+func TestServeValidatePod(t *testing.T) {
+	setupPoolConfigDir(t)
+	container := poolContainer("cputestcontainer", map[string]string{"exclusive_nonexisting": "1"})
+	for _, version := range admissionVersions {
+		t.Run(version, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/validating-pods", bytes.NewBuffer(setAdmissionVersion(t, createAdmReviewReq(t, []corev1.Container{container}), version)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(serveValidatePod).ServeHTTP(rr, req)
+			var admReviewResp admissionv1.AdmissionReview
+			if err := json.Unmarshal(rr.Body.Bytes(), &admReviewResp); err != nil || admReviewResp.Response == nil {
+				t.Fatalf("Admission review could not be unmarshalled: %v, body: %s", err, rr.Body.String())
+			}
+			if admReviewResp.APIVersion != version || admReviewResp.Response.Allowed {
+				t.Errorf("Pod requesting a non-existing pool was allowed, or answered in the wrong version: %s", rr.Body.String())
+			}
+		})
+	}
+}
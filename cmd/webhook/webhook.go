@@ -14,11 +14,13 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/nokia/CPU-Pooler/pkg/types"
+	admissionv1 "k8s.io/api/admission/v1"
 	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
 const (
@@ -33,14 +35,21 @@ var (
 	codecs             = serializer.NewCodecFactory(scheme)
 	resourceBaseName   = "nokia.k8s.io"
 	processStarterPath = "/opt/bin/process-starter"
+	cpusetWaitTimeout  = 30 * time.Second
 	certFile           string
 	keyFile            string
 	cfsQuotas          string
 )
 
+func init() {
+	utilruntime.Must(admissionv1.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+}
+
 type containerPoolRequests struct {
 	sharedCPURequests    int
 	exclusiveCPURequests int
+	sharedPoolName       string
 	pools                map[string]int
 }
 
@@ -52,8 +61,8 @@ type patch struct {
 	Value json.RawMessage `json:"value"`
 }
 
-func toAdmissionResponse(err error) *v1beta1.AdmissionResponse {
-	return &v1beta1.AdmissionResponse{
+func toAdmissionResponse(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
 		Result: &metav1.Status{
 			Message: err.Error(),
 		},
@@ -76,13 +85,18 @@ func getCPUPoolRequests(pod *corev1.Pod) (poolRequestMap, error) {
 					glog.Errorf("Cannot convert cpu request to int %s:%s", key, value.String())
 					return poolRequestMap{}, err
 				}
+				poolName := strings.TrimPrefix(string(key), resourceBaseName+"/")
 				if strings.HasPrefix(string(key), resourceBaseName+"/shared") {
+					//The SHARED_CPUS environment variable of a container can only describe one shared pool
+					if cPoolRequests.sharedPoolName != "" && cPoolRequests.sharedPoolName != poolName {
+						return poolRequestMap{}, fmt.Errorf("Container %s requests CPUs from more than one shared pool: %s, %s", c.Name, cPoolRequests.sharedPoolName, poolName)
+					}
+					cPoolRequests.sharedPoolName = poolName
 					cPoolRequests.sharedCPURequests += val
 				}
 				if strings.HasPrefix(string(key), resourceBaseName+"/exclusive") {
 					cPoolRequests.exclusiveCPURequests += val
 				}
-				poolName := strings.TrimPrefix(string(key), resourceBaseName+"/")
 				cPoolRequests.pools[poolName] = val
 				poolRequests[c.Name] = cPoolRequests
 			}
@@ -120,6 +134,13 @@ func validateAnnotation(poolRequests poolRequestMap, cpuAnnotation types.CPUAnno
 					cpuAnnotation.ContainerTotalCPURequest(pool, cName))
 			}
 		}
+		// Real-time processes never yield their CPUs, so they would starve everyone else sharing the same CPUs
+		for _, process := range cpuAnnotation[cName].Processes {
+			if types.IsRealTimeSchedPolicy(process.SchedPolicy) && types.DeterminePoolType(process.PoolName) != types.ExclusivePoolID {
+				return fmt.Errorf("Container %s; Process %s asks for real-time scheduling policy %s from pool %s, which is only allowed for exclusive pools",
+					cName, process.ProcName, process.SchedPolicy, process.PoolName)
+			}
+		}
 	}
 	return nil
 }
@@ -154,15 +175,9 @@ func getMaxSharedPoolLimit(requests containerPoolRequests, contSpec *corev1.Cont
 		glog.Warningf("Container %s asked for mixed allocations but pool configs could not be read to determine proper CFS limit - only exclusive allocations are accounted for properly", contSpec.Name)
 		return requests.sharedCPURequests
 	}
-	var sharedPoolName string
-	for poolName, request := range requests.pools {
-		if request == requests.sharedCPURequests {
-			sharedPoolName = poolName
-		}
-	}
 	maxSharedPoolSize := 0
 	for _, poolConf := range poolConfs {
-		if pool, ok := poolConf.Pools[sharedPoolName]; ok {
+		if pool, ok := poolConf.Pools[requests.sharedPoolName]; ok {
 			if pool.CPUset.Size()*1000 > maxSharedPoolSize {
 				maxSharedPoolSize = pool.CPUset.Size() * 1000
 			}
@@ -261,6 +276,11 @@ func patchContainerForPinning(cpuAnnotation types.CPUAnnotation, patchList []pat
 	patchItem.Value = json.RawMessage(contNameEnvPatch)
 	patchList = append(patchList, patchItem)
 
+	// Time process starter waits for the cpuset of the container to be provisioned
+	patchItem.Path = "/spec/containers/" + strconv.Itoa(i) + "/env/-"
+	patchItem.Value = json.RawMessage(`{"name":"CPUSET_WAIT_TIMEOUT","value":"` + cpusetWaitTimeout.String() + `" }`)
+	patchList = append(patchList, patchItem)
+
 	// Overwrite entrypoint
 	patchItem.Path = "/spec/containers/" + strconv.Itoa(i) + "/command"
 	contEPPatch := `[ "` + processStarterPath + `" ]`
@@ -297,7 +317,7 @@ func patchVolumesForPinning(patchList []patch) []patch {
 	return patchList
 }
 
-func mutatePods(ar v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
+func mutatePods(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
 	glog.V(2).Info("mutating pods")
 	var (
 		patchList         []patch
@@ -319,7 +339,7 @@ func mutatePods(ar v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
 		glog.Error(err)
 		return toAdmissionResponse(err)
 	}
-	reviewResponse := v1beta1.AdmissionResponse{}
+	reviewResponse := admissionv1.AdmissionResponse{}
 
 	annotationName := annotationNameFromConfig()
 
@@ -411,7 +431,7 @@ func mutatePods(ar v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
 			return toAdmissionResponse(err)
 		}
 		reviewResponse.Patch = []byte(patch)
-		pt := v1beta1.PatchTypeJSONPatch
+		pt := admissionv1.PatchTypeJSONPatch
 		reviewResponse.PatchType = &pt
 	}
 
@@ -419,6 +439,12 @@ func mutatePods(ar v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
 }
 
 func serveMutatePod(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, mutatePods)
+}
+
+//serveAdmissionReview decodes the AdmissionReview sent by the API server, and answers it in the same admission.k8s.io version it was sent in
+//v1beta1 reviews are converted to v1 before being handed over to the admit function, so admit functions only need to handle v1
+func serveAdmissionReview(w http.ResponseWriter, r *http.Request, admit func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse) {
 	var body []byte
 	if r.Body != nil {
 		if data, err := ioutil.ReadAll(r.Body); err == nil {
@@ -433,24 +459,49 @@ func serveMutatePod(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestedAdmissionReview := v1beta1.AdmissionReview{}
-
-	responseAdmissionReview := v1beta1.AdmissionReview{}
-
 	deserializer := codecs.UniversalDeserializer()
-	if _, _, err := deserializer.Decode(body, nil, &requestedAdmissionReview); err != nil {
-		glog.Error(err)
-		responseAdmissionReview.Response = toAdmissionResponse(err)
-	} else {
-		responseAdmissionReview.Response = mutatePods(requestedAdmissionReview)
+	obj, gvk, err := deserializer.Decode(body, nil, nil)
+	if err != nil {
+		glog.Errorf("Request could not be decoded: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
-
-	respBytes, err := json.Marshal(responseAdmissionReview)
+	var responseObj runtime.Object
+	switch requestedAdmissionReview := obj.(type) {
+	case *admissionv1.AdmissionReview:
+		if requestedAdmissionReview.Request == nil {
+			http.Error(w, "AdmissionReview does not contain a request", http.StatusBadRequest)
+			return
+		}
+		responseAdmissionReview := &admissionv1.AdmissionReview{}
+		responseAdmissionReview.SetGroupVersionKind(*gvk)
+		responseAdmissionReview.Response = admitOrReject(admit, *requestedAdmissionReview)
+		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
+		responseObj = responseAdmissionReview
+	case *v1beta1.AdmissionReview:
+		if requestedAdmissionReview.Request == nil {
+			http.Error(w, "AdmissionReview does not contain a request", http.StatusBadRequest)
+			return
+		}
+		responseAdmissionReview := &v1beta1.AdmissionReview{}
+		responseAdmissionReview.SetGroupVersionKind(*gvk)
+		v1Review := admissionv1.AdmissionReview{Request: convertAdmissionRequestToV1(requestedAdmissionReview.Request)}
+		responseAdmissionReview.Response = convertAdmissionResponseToV1beta1(admitOrReject(admit, v1Review))
+		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
+		responseObj = responseAdmissionReview
+	default:
+		msg := fmt.Sprintf("Unsupported group version kind: %v", gvk)
+		glog.Error(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
 
+	respBytes, err := json.Marshal(responseObj)
 	if err != nil {
 		glog.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 
@@ -459,6 +510,52 @@ func serveMutatePod(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//admitOrReject protects against admit functions not returning any response (e.g. the request was not about a Pod), which is answered with a rejection
+func admitOrReject(admit func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse, ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	response := admit(ar)
+	if response == nil {
+		return toAdmissionResponse(errors.New("request for resource: " + ar.Request.Resource.String() + " cannot be handled"))
+	}
+	return response
+}
+
+func convertAdmissionRequestToV1(request *v1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	return &admissionv1.AdmissionRequest{
+		UID:                request.UID,
+		Kind:               request.Kind,
+		Resource:           request.Resource,
+		SubResource:        request.SubResource,
+		RequestKind:        request.RequestKind,
+		RequestResource:    request.RequestResource,
+		RequestSubResource: request.RequestSubResource,
+		Name:               request.Name,
+		Namespace:          request.Namespace,
+		Operation:          admissionv1.Operation(request.Operation),
+		UserInfo:           request.UserInfo,
+		Object:             request.Object,
+		OldObject:          request.OldObject,
+		DryRun:             request.DryRun,
+		Options:            request.Options,
+	}
+}
+
+func convertAdmissionResponseToV1beta1(response *admissionv1.AdmissionResponse) *v1beta1.AdmissionResponse {
+	var patchType *v1beta1.PatchType
+	if response.PatchType != nil {
+		convertedType := v1beta1.PatchType(*response.PatchType)
+		patchType = &convertedType
+	}
+	return &v1beta1.AdmissionResponse{
+		UID:              response.UID,
+		Allowed:          response.Allowed,
+		Result:           response.Result,
+		Patch:            response.Patch,
+		PatchType:        patchType,
+		AuditAnnotations: response.AuditAnnotations,
+		Warnings:         response.Warnings,
+	}
+}
+
 func main() {
 	flag.StringVar(&certFile, "tls-cert-file", certFile, ""+
 		"File containing the default x509 Certificate for HTTPS. (CA cert, if any, concatenated "+
@@ -467,6 +564,8 @@ func main() {
 		"File containing the default x509 private key matching --tls-cert-file.")
 	flag.StringVar(&processStarterPath, "process-starter-path", processStarterPath, ""+
 		"Path to process-starter binary file. Optional parameter, default path is /opt/bin/process-starter.")
+	flag.DurationVar(&cpusetWaitTimeout, "cpuset-wait-timeout", cpusetWaitTimeout, ""+
+		"How long process-starter waits for the cpuset of the container to be provisioned before failing the container. Optional parameter, default is 30s.")
 	flag.StringVar(&cfsQuotas, "cfs-quotas", QuotaAll,
 		"Controls if CPU-Pooler automatically provisions CFS quotas for its managed containers.\n"+
 			"Possible values are:\n"+
@@ -474,15 +573,19 @@ func main() {
 			"'shared' - CPU-Pooler doesn't provision quotas for containers using exclusive pools")
 	flag.Parse()
 
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	certReloader, err := newCertificateReloader(certFile, keyFile)
 	if err != nil {
 		glog.Fatal(err)
 	}
+	if err = certReloader.watch(make(chan struct{})); err != nil {
+		glog.Warningf("TLS certificate files cannot be watched, rotated certificates are only served after restart: %v", err)
+	}
 
 	http.HandleFunc("/mutating-pods", serveMutatePod)
+	http.HandleFunc("/validating-pods", serveValidatePod)
 	server := &http.Server{
 		Addr:         ":443",
-		TLSConfig:    &tls.Config{Certificates: []tls.Certificate{cert}},
+		TLSConfig:    &tls.Config{GetCertificate: certReloader.GetCertificate},
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
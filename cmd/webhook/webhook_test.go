@@ -9,12 +9,19 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/nokia/CPU-Pooler/pkg/types"
+
+	admissionv1 "k8s.io/api/admission/v1"
 	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var processStarterTestPath = "/opt/bin/process-starter"
+var (
+	processStarterTestPath = "/opt/bin/process-starter"
+	admissionVersions      = []string{admissionv1.SchemeGroupVersion.String(), v1beta1.SchemeGroupVersion.String()}
+)
 
 func createAdmReviewReq(t *testing.T, containers []corev1.Container) []byte {
 	pod := corev1.Pod{}
@@ -26,8 +33,8 @@ func createAdmReviewReq(t *testing.T, containers []corev1.Container) []byte {
 	if err != nil {
 		t.FailNow()
 	}
-	admReviewReq := v1beta1.AdmissionReview{}
-	admReq := v1beta1.AdmissionRequest{}
+	admReviewReq := admissionv1.AdmissionReview{TypeMeta: metav1.TypeMeta{APIVersion: admissionv1.SchemeGroupVersion.String(), Kind: "AdmissionReview"}}
+	admReq := admissionv1.AdmissionRequest{}
 	admReq.Object.Raw = podjs
 	admReq.Resource = metav1.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
 	admReviewReq.Request = &admReq
@@ -100,8 +107,33 @@ func checkPatches(t *testing.T, patches []patch, checkedPatches []patch, expecte
 	}
 }
 
-func handleAndChekAdmReview(t *testing.T, admReviewReq []byte, expectedPatches []patch, unexpectedPatches []patch) v1beta1.AdmissionReview {
-	var admReviewResp v1beta1.AdmissionReview
+//handleAndChekAdmReview sends the review to the webhook in every supported admission.k8s.io version, and checks the answers given in each
+func handleAndChekAdmReview(t *testing.T, admReviewReq []byte, expectedPatches []patch, unexpectedPatches []patch) []admissionv1.AdmissionReview {
+	admReviewResps := make([]admissionv1.AdmissionReview, 0, len(admissionVersions))
+	for _, version := range admissionVersions {
+		t.Run(version, func(t *testing.T) {
+			admReviewResps = append(admReviewResps, handleAndChekAdmReviewVersion(t, setAdmissionVersion(t, admReviewReq, version), version, expectedPatches, unexpectedPatches))
+		})
+	}
+	return admReviewResps
+}
+
+func setAdmissionVersion(t *testing.T, admReviewReq []byte, version string) []byte {
+	var review map[string]interface{}
+	if err := json.Unmarshal(admReviewReq, &review); err != nil {
+		t.Fatalf("Admission review request could not be parsed: %v", err)
+	}
+	review["apiVersion"] = version
+	versionedReq, err := json.Marshal(review)
+	if err != nil {
+		t.Fatalf("Admission review request could not be marshalled: %v", err)
+	}
+	return versionedReq
+}
+
+func handleAndChekAdmReviewVersion(t *testing.T, admReviewReq []byte, version string, expectedPatches []patch, unexpectedPatches []patch) admissionv1.AdmissionReview {
+	//The two versions only differ in their apiVersion, so answers of both can be unmarshalled into the v1 struct
+	var admReviewResp admissionv1.AdmissionReview
 	var patches []patch
 
 	req, err := http.NewRequest("GET", "/mutatePods", bytes.NewBuffer([]byte(admReviewReq)))
@@ -124,6 +156,9 @@ func handleAndChekAdmReview(t *testing.T, admReviewReq []byte, expectedPatches [
 		t.FailNow()
 
 	}
+	if admReviewResp.APIVersion != version {
+		t.Errorf("Admission review answered in version %s instead of %s", admReviewResp.APIVersion, version)
+	}
 	if nil != admReviewResp.Response.Patch {
 		if err := json.Unmarshal([]byte(admReviewResp.Response.Patch), &patches); err != nil {
 			t.Errorf("Admission review response patch unmarshal error %v:%v\n", err, rr.Body)
@@ -197,6 +232,8 @@ func TestMutatePodExclusiveCpu(t *testing.T) {
 			Value: json.RawMessage(patchValueVolMnt)},
 		patch{Op: "add", Path: "/spec/containers/0/env",
 			Value: json.RawMessage(`[{"name": "CONTAINER_NAME", "value": "cputestcontainer"}]`)},
+		patch{Op: "add", Path: "/spec/containers/0/env/-",
+			Value: json.RawMessage(`{"name": "CPUSET_WAIT_TIMEOUT", "value": "30s"}`)},
 		patch{Op: "add", Path: "/spec/containers/0/command",
 			Value: json.RawMessage(patchValueCommand)},
 		patch{Op: "add", Path: "/spec/volumes/-",
@@ -218,14 +255,15 @@ func TestMutatePodWrongPoolValueRequest(t *testing.T) {
 }
 func TestMutatePodWrongExclusivePoolValueRequest(t *testing.T) {
 
-	admReviewReq, err := ioutil.ReadFile("../../test/testdata/pod-spec-wrong-excl-pool-value-req.json")
+	admReviewReq, err := ioutil.ReadFile("../../test/testdata/pod-spec-excl-pool-annotation-over-limit-req.json")
 	if err != nil {
 		t.Errorf("Could not read pod spec")
 	}
 
-	admReviewResp := handleAndChekAdmReview(t, admReviewReq, nil, nil)
-	if admReviewResp.Response.Allowed == true {
-		t.Errorf("Pod unexpectedly allowed")
+	for _, admReviewResp := range handleAndChekAdmReview(t, admReviewReq, nil, nil) {
+		if admReviewResp.Response.Allowed == true {
+			t.Errorf("Pod unexpectedly allowed in version %s", admReviewResp.APIVersion)
+		}
 	}
 }
 
@@ -276,3 +314,47 @@ func TestMutateBothPoolTypesRequestedInResource(t *testing.T) {
 
 	handleAndChekAdmReview(t, admReviewReq, expectedPatches, nil)
 }
+
+func TestMutateMultipleSharedPoolsRequested(t *testing.T) {
+	container := corev1.Container{Name: "cputestcontainer"}
+	container.Resources.Limits = corev1.ResourceList{
+		"nokia.k8s.io/shared_controlplane": resource.MustParse("100"),
+		"nokia.k8s.io/shared_dataplane":    resource.MustParse("200"),
+	}
+	for _, admReviewResp := range handleAndChekAdmReview(t, createAdmReviewReq(t, []corev1.Container{container}), nil, nil) {
+		if admReviewResp.Response.Allowed == true {
+			t.Errorf("Pod requesting from two shared pools in one container unexpectedly allowed in version %s", admReviewResp.APIVersion)
+		}
+	}
+}
+
+func TestValidateAnnotationRealTimeSchedPolicy(t *testing.T) {
+	poolRequests := poolRequestMap{"cputestcontainer": containerPoolRequests{
+		sharedCPURequests:    100,
+		exclusiveCPURequests: 1,
+		pools:                map[string]int{"exclusive_caas": 1, "shared_caas": 100},
+	}}
+	var tcs = []struct {
+		name          string
+		processes     []types.Process
+		isErrExpected bool
+	}{
+		{name: "exclusive", processes: []types.Process{
+			{ProcName: "/bin/dpdk", CPUs: 1, PoolName: "exclusive_caas", SchedPolicy: types.SchedPolicyFIFO, Priority: 50},
+			{ProcName: "/bin/helper", CPUs: 100, PoolName: "shared_caas", Nice: 10},
+		}},
+		{name: "shared", isErrExpected: true, processes: []types.Process{
+			{ProcName: "/bin/dpdk", CPUs: 1, PoolName: "exclusive_caas"},
+			{ProcName: "/bin/helper", CPUs: 100, PoolName: "shared_caas", SchedPolicy: types.SchedPolicyRR, Priority: 10},
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cpuAnnotation := types.CPUAnnotation{"cputestcontainer": types.Container{Name: "cputestcontainer", Processes: tc.processes}}
+			err := validateAnnotation(poolRequests, cpuAnnotation)
+			if (err != nil) != tc.isErrExpected {
+				t.Errorf("Unexpected validation result, error expected: %v, actual: %v", tc.isErrExpected, err)
+			}
+		})
+	}
+}
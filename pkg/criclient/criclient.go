@@ -0,0 +1,158 @@
+package criclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+const (
+	//DefaultSocket is the location of the CRI socket of containerd
+	DefaultSocket = "/run/containerd/containerd.sock"
+	//ConnectionTimeout controls how long we wait for the container runtime to answer
+	ConnectionTimeout = 10 * time.Second
+	//podUIDLabel is the label kubelet puts on every Pod sandbox to identify the Pod it belongs to
+	podUIDLabel = "io.kubernetes.pod.uid"
+)
+
+//Client locates the cgroups of containers and Pod sandboxes by asking the container runtime over its CRI socket
+type Client struct {
+	socket string
+}
+
+//verboseInfo is the part of the verbose status information of containers and sandboxes describing their OCI runtime spec
+//Both containerd and CRI-O publish it under the "info" key
+type verboseInfo struct {
+	RuntimeSpec struct {
+		Linux struct {
+			CgroupsPath string `json:"cgroupsPath"`
+		} `json:"linux"`
+	} `json:"runtimeSpec"`
+}
+
+//NewClient creates a Client talking to the container runtime on the provided socket
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+//IsAvailable tells whether the CRI socket of the container runtime exists
+//Callers are expected to fall back to discovering the cgroups from cgroupfs when it does not
+//An unused hostPath mount shows up as an empty directory in place of the socket, which does not count either
+func (client *Client) IsAvailable() bool {
+	if client == nil || client.socket == "" {
+		return false
+	}
+	socketInfo, err := os.Stat(client.socket)
+	return err == nil && socketInfo.Mode()&os.ModeSocket != 0
+}
+
+//GetContainerCgroupPath returns the cgroup of a container relative to the root of the cgroupfs hierarchy, as reported by the container runtime
+func (client *Client) GetContainerCgroupPath(containerID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeout)
+	defer cancel()
+	conn, err := client.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	resp, err := criapi.NewRuntimeServiceClient(conn).ContainerStatus(ctx, &criapi.ContainerStatusRequest{ContainerId: containerID, Verbose: true})
+	if err != nil {
+		return "", fmt.Errorf("CRI ContainerStatus call failed for container: %s because: %s", containerID, err)
+	}
+	return parseCgroupPath(resp.GetInfo())
+}
+
+//GetPodSandboxCgroupPath returns the cgroup of the ready sandbox (i.e. the infra container) of a Pod relative to the root of the cgroupfs hierarchy
+func (client *Client) GetPodSandboxCgroupPath(podUID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeout)
+	defer cancel()
+	conn, err := client.connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	runtimeClient := criapi.NewRuntimeServiceClient(conn)
+	sandboxes, err := runtimeClient.ListPodSandbox(ctx, &criapi.ListPodSandboxRequest{Filter: &criapi.PodSandboxFilter{
+		State:         &criapi.PodSandboxStateValue{State: criapi.PodSandboxState_SANDBOX_READY},
+		LabelSelector: map[string]string{podUIDLabel: podUID},
+	}})
+	if err != nil {
+		return "", fmt.Errorf("CRI ListPodSandbox call failed for Pod: %s because: %s", podUID, err)
+	}
+	if len(sandboxes.GetItems()) != 1 {
+		return "", fmt.Errorf("expected exactly one ready sandbox for Pod: %s, the container runtime reported: %d", podUID, len(sandboxes.GetItems()))
+	}
+	resp, err := runtimeClient.PodSandboxStatus(ctx, &criapi.PodSandboxStatusRequest{PodSandboxId: sandboxes.GetItems()[0].GetId(), Verbose: true})
+	if err != nil {
+		return "", fmt.Errorf("CRI PodSandboxStatus call failed for Pod: %s because: %s", podUID, err)
+	}
+	return parseCgroupPath(resp.GetInfo())
+}
+
+func (client *Client) connect(ctx context.Context) (*grpc.ClientConn, error) {
+	conn, err := grpc.DialContext(ctx, client.socket, grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("container runtime could not be reached on CRI socket: %s because: %s", client.socket, err)
+	}
+	return conn, nil
+}
+
+func parseCgroupPath(info map[string]string) (string, error) {
+	rawInfo, exists := info["info"]
+	if !exists {
+		return "", errors.New("container runtime did not return verbose status information")
+	}
+	var parsedInfo verboseInfo
+	if err := json.Unmarshal([]byte(rawInfo), &parsedInfo); err != nil {
+		return "", errors.New("verbose status information of the container runtime could not be parsed because: " + err.Error())
+	}
+	if parsedInfo.RuntimeSpec.Linux.CgroupsPath == "" {
+		return "", errors.New("container runtime did not report a cgroup path")
+	}
+	return ToCgroupfsPath(parsedInfo.RuntimeSpec.Linux.CgroupsPath), nil
+}
+
+//ToCgroupfsPath converts the cgroupsPath of an OCI runtime spec into a path relative to the root of the cgroupfs hierarchy
+//The systemd cgroup driver describes cgroups as "slice:prefix:name", which is expanded to the nested slices and the scope systemd creates for it
+func ToCgroupfsPath(cgroupsPath string) string {
+	parts := strings.Split(cgroupsPath, ":")
+	if len(parts) != 3 {
+		return cgroupsPath
+	}
+	slice, prefix, name := parts[0], parts[1], parts[2]
+	unit := name
+	if !strings.HasSuffix(name, ".slice") {
+		unit = name + ".scope"
+		if prefix != "" {
+			unit = prefix + "-" + unit
+		}
+	}
+	return expandSlice(slice) + "/" + unit
+}
+
+//expandSlice returns the path of a systemd slice, e.g. "/kubepods.slice/kubepods-besteffort.slice" for "kubepods-besteffort.slice"
+func expandSlice(slice string) string {
+	sliceName := strings.TrimSuffix(slice, ".slice")
+	if sliceName == "" || sliceName == "-" {
+		return ""
+	}
+	var path, prefix string
+	for _, component := range strings.Split(sliceName, "-") {
+		prefix += component
+		path += "/" + prefix + ".slice"
+		prefix += "-"
+	}
+	return path
+}
@@ -0,0 +1,64 @@
+package criclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/test/utils"
+)
+
+func TestToCgroupfsPath(t *testing.T) {
+	var testCases = []struct {
+		cgroupsPath  string
+		expectedPath string
+	}{
+		{"/kubepods/besteffort/pod0001/cont01", "/kubepods/besteffort/pod0001/cont01"},
+		{"kubepods-besteffort-pod0001.slice:cri-containerd:cont01", "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0001.slice/cri-containerd-cont01.scope"},
+		{"kubepods-pod0002.slice:crio:cont02", "/kubepods.slice/kubepods-pod0002.slice/crio-cont02.scope"},
+		{"kubepods-burstable-pod0003.slice::cont03", "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0003.slice/cont03.scope"},
+		{"-.slice:docker:cont04", "/docker-cont04.scope"},
+	}
+	for _, testCase := range testCases {
+		if path := ToCgroupfsPath(testCase.cgroupsPath); path != testCase.expectedPath {
+			t.Errorf("Conversion of cgroupsPath: %s failed, expected: %s, actual: %s", testCase.cgroupsPath, testCase.expectedPath, path)
+		}
+	}
+}
+
+func TestGetCgroupPaths(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "cri.sock")
+	client := NewClient(socket)
+	if client.IsAvailable() {
+		t.Errorf("Client reported availability without a socket")
+	}
+	os.Mkdir(socket, 0755)
+	if client.IsAvailable() {
+		t.Errorf("Client reported availability with a directory in place of the socket")
+	}
+	os.Remove(socket)
+	fakeServer, err := utils.StartFakeCRIServer(socket,
+		map[string]string{"cont01": "kubepods-besteffort-pod0001.slice:cri-containerd:cont01"},
+		map[string]utils.FakeSandbox{"infrac1": {PodUID: "0001", CgroupPath: "/kubepods/besteffort/pod0001/infrac1"}})
+	if err != nil {
+		t.Fatalf("Fake CRI server could not be started: %s", err.Error())
+	}
+	defer fakeServer.Stop()
+	if !client.IsAvailable() {
+		t.Errorf("Client did not report availability with an existing socket")
+	}
+	containerPath, err := client.GetContainerCgroupPath("cont01")
+	if err != nil || containerPath != "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0001.slice/cri-containerd-cont01.scope" {
+		t.Errorf("Unexpected cgroup path of container: %s, error: %v", containerPath, err)
+	}
+	if _, err = client.GetContainerCgroupPath("unknown"); err == nil {
+		t.Errorf("Cgroup path of an unknown container was returned")
+	}
+	sandboxPath, err := client.GetPodSandboxCgroupPath("0001")
+	if err != nil || sandboxPath != "/kubepods/besteffort/pod0001/infrac1" {
+		t.Errorf("Unexpected cgroup path of sandbox: %s, error: %v", sandboxPath, err)
+	}
+	if _, err = client.GetPodSandboxCgroupPath("0002"); err == nil {
+		t.Errorf("Cgroup path of the sandbox of an unknown Pod was returned")
+	}
+}
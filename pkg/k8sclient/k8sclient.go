@@ -43,9 +43,21 @@ func SetPodAnnotation(pod v1.Pod, key string, value string) error {
 	if err != nil {
 		return err
 	}
+	return PatchPodAnnotations(cSet, pod, map[string]string{key: value})
+}
+
+// PatchPodAnnotations adds or modifies multiple annotations of pod in one request through the provided client
+// Values are escaped, so they can carry structured (e.g. json) content
+func PatchPodAnnotations(cSet kubernetes.Interface, pod v1.Pod, annotations map[string]string) error {
 	merge := update{}
 	merge.Metadata.Annotations = make(map[string]json.RawMessage)
-	merge.Metadata.Annotations[key] = json.RawMessage(`"` + value + `"`)
+	for key, value := range annotations {
+		escapedValue, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		merge.Metadata.Annotations[key] = json.RawMessage(escapedValue)
+	}
 
 	jsonData, err := json.Marshal(merge)
 	if err != nil {
@@ -0,0 +1,40 @@
+package podresources
+
+import (
+	"fmt"
+
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+//GetPodResourcesMethod is the full name of the Get call of the v1 PodResources API, served by kubelet since Kubernetes 1.27
+const GetPodResourcesMethod = "/v1.PodResourcesLister/Get"
+
+//GetPodResourcesRequest is the request of the Get call of the v1 PodResources API
+//The vendored API predates the call, so its messages are declared here with the wire format of the upstream API
+type GetPodResourcesRequest struct {
+	PodName      string `protobuf:"bytes,1,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	PodNamespace string `protobuf:"bytes,2,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+}
+
+//Reset implements proto.Message
+func (m *GetPodResourcesRequest) Reset() { *m = GetPodResourcesRequest{} }
+
+//String implements proto.Message
+func (m *GetPodResourcesRequest) String() string { return fmt.Sprintf("%+v", *m) }
+
+//ProtoMessage implements proto.Message
+func (*GetPodResourcesRequest) ProtoMessage() {}
+
+//GetPodResourcesResponse is the response of the Get call of the v1 PodResources API, carrying the resources of one Pod
+type GetPodResourcesResponse struct {
+	PodResources *podresourcesapi.PodResources `protobuf:"bytes,1,opt,name=pod_resources,json=podResources,proto3" json:"pod_resources,omitempty"`
+}
+
+//Reset implements proto.Message
+func (m *GetPodResourcesResponse) Reset() { *m = GetPodResourcesResponse{} }
+
+//String implements proto.Message
+func (m *GetPodResourcesResponse) String() string { return fmt.Sprintf("%+v", *m) }
+
+//ProtoMessage implements proto.Message
+func (*GetPodResourcesResponse) ProtoMessage() {}
@@ -0,0 +1,233 @@
+package podresources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/checkpoint"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/api/core/v1"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	//DefaultSocket is the location of the kubelet PodResources API socket
+	DefaultSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+	//DefaultCheckpointFile is the location of the kubelet Device Manager's internal checkpoint file
+	DefaultCheckpointFile = "/var/lib/kubelet/device-plugins/kubelet_internal_checkpoint"
+	//ConnectionTimeout controls how long we wait for the kubelet PodResources API to answer
+	ConnectionTimeout = 10 * time.Second
+	//kubeletGetDisabledMessage is the message kubelet fails the Get call with while its KubeletPodResourcesGet feature gate is disabled
+	kubeletGetDisabledMessage = "PodResources API Get method disabled"
+)
+
+//Client reads the Device allocations of the containers from kubelet
+//The versioned PodResources API is used whenever its socket exists, the kubelet checkpoint file is only parsed in lieu of it
+//The connection to the API is kept open, and re-established in the background by gRPC whenever kubelet restarts
+type Client struct {
+	socket         string
+	checkpointFile string
+	connLock       sync.Mutex
+	conn           *grpc.ClientConn
+	//getUnsupported is set once kubelet turned out not to serve the Get call, so later lookups go to List straight away
+	getUnsupported int32
+}
+
+//NewClient creates a Client talking to the PodResources API on the provided socket, falling back to the provided checkpoint file when the socket is missing
+func NewClient(socket string, checkpointFile string) *Client {
+	return &Client{socket: socket, checkpointFile: checkpointFile}
+}
+
+//GetContainerDeviceIDs returns the IDs of the Devices of the provided resource kubelet allocated to one container of a Pod
+func (client *Client) GetContainerDeviceIDs(pod v1.Pod, containerName string, resourceName string) ([]string, error) {
+	if _, err := os.Stat(client.socket); os.IsNotExist(err) {
+		return client.getDeviceIDsFromCheckpoint(pod, containerName, resourceName)
+	}
+	podResources, err := client.getPodResources(pod)
+	if err != nil {
+		return nil, err
+	}
+	deviceIDs := []string{}
+	for _, podResource := range podResources {
+		if podResource.GetName() != pod.ObjectMeta.Name || podResource.GetNamespace() != pod.ObjectMeta.Namespace {
+			continue
+		}
+		for _, containerResource := range podResource.GetContainers() {
+			if containerResource.GetName() != containerName {
+				continue
+			}
+			for _, devices := range containerResource.GetDevices() {
+				if devices.GetResourceName() == resourceName {
+					deviceIDs = append(deviceIDs, devices.GetDeviceIds()...)
+				}
+			}
+		}
+	}
+	return deviceIDs, nil
+}
+
+//GetAllocatedDeviceIDs returns the IDs of all the Devices of the provided resource kubelet currently allocated to any container running on the Node
+func (client *Client) GetAllocatedDeviceIDs(resourceName string) ([]string, error) {
+	allocatedDeviceIDs, err := client.GetAllocatedDeviceIDsPerResource()
+	if err != nil {
+		return nil, err
+	}
+	if deviceIDs, exists := allocatedDeviceIDs[resourceName]; exists {
+		return deviceIDs, nil
+	}
+	return []string{}, nil
+}
+
+//GetAllocatedDeviceIDsPerResource returns the IDs of all the Devices kubelet currently allocated to any container running on the Node, grouped by the name of their resource
+//The allocations of every resource are read at once, so callers interested in multiple resources do not need to ask kubelet multiple times
+func (client *Client) GetAllocatedDeviceIDsPerResource() (map[string][]string, error) {
+	if _, err := os.Stat(client.socket); os.IsNotExist(err) {
+		return client.getAllocatedDeviceIDsFromCheckpoint()
+	}
+	podResources, err := client.listPodResources()
+	if err != nil {
+		return nil, err
+	}
+	allocatedDeviceIDs := map[string][]string{}
+	for _, podResource := range podResources {
+		for _, containerResource := range podResource.GetContainers() {
+			for _, devices := range containerResource.GetDevices() {
+				allocatedDeviceIDs[devices.GetResourceName()] = append(allocatedDeviceIDs[devices.GetResourceName()], devices.GetDeviceIds()...)
+			}
+		}
+	}
+	return allocatedDeviceIDs, nil
+}
+
+//Close closes the connection to the PodResources API, if any was opened
+func (client *Client) Close() error {
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	if client.conn == nil {
+		return nil
+	}
+	err := client.conn.Close()
+	client.conn = nil
+	return err
+}
+
+func (client *Client) connection() (*grpc.ClientConn, error) {
+	client.connLock.Lock()
+	defer client.connLock.Unlock()
+	if client.conn != nil {
+		return client.conn, nil
+	}
+	conn, err := grpc.Dial(client.socket, grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("kubelet PodResources API could not be reached on socket: %s because: %s", client.socket, err)
+	}
+	client.conn = conn
+	return conn, nil
+}
+
+//getPodResources returns the resources of the provided Pod with the Get call of the API, or the resources of every Pod of the Node with List,
+//if kubelet does not serve Get (i.e. it is older than 1.27, or its KubeletPodResourcesGet feature gate is disabled), or does not know the Pod
+func (client *Client) getPodResources(pod v1.Pod) ([]*podresourcesapi.PodResources, error) {
+	if atomic.LoadInt32(&client.getUnsupported) == 0 {
+		conn, err := client.connection()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeout)
+		defer cancel()
+		resp := &GetPodResourcesResponse{}
+		err = conn.Invoke(ctx, GetPodResourcesMethod, &GetPodResourcesRequest{PodName: pod.ObjectMeta.Name, PodNamespace: pod.ObjectMeta.Namespace}, resp, grpc.WaitForReady(true))
+		if err == nil {
+			return []*podresourcesapi.PodResources{resp.PodResources}, nil
+		}
+		if isGetUnsupported(err) {
+			atomic.StoreInt32(&client.getUnsupported, 1)
+		}
+	}
+	return client.listPodResources()
+}
+
+//isGetUnsupported tells whether kubelet failed the Get call because it does not serve it at all, and not because of the Pod, or a transient problem
+//Kubelets older than 1.27 do not know the call. Newer ones with the KubeletPodResourcesGet feature gate disabled fail it with a plain error,
+//which reaches the client with the Unknown code, so it can only be told apart by its exact message
+func isGetUnsupported(err error) bool {
+	switch status.Code(err) {
+	case codes.Unimplemented:
+		return true
+	case codes.Unknown:
+		return status.Convert(err).Message() == kubeletGetDisabledMessage
+	}
+	return false
+}
+
+func (client *Client) listPodResources() ([]*podresourcesapi.PodResources, error) {
+	conn, err := client.connection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ConnectionTimeout)
+	defer cancel()
+	//Calls wait for the connection to be (re-)established, e.g. after a restart of kubelet, instead of failing right away
+	resp, err := podresourcesapi.NewPodResourcesListerClient(conn).List(ctx, &podresourcesapi.ListPodResourcesRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		return nil, fmt.Errorf("kubelet PodResources API List call failed because: %s", err)
+	}
+	return resp.GetPodResources(), nil
+}
+
+func (client *Client) getDeviceIDsFromCheckpoint(pod v1.Pod, containerName string, resourceName string) ([]string, error) {
+	cp, err := client.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	podIDStr := string(pod.ObjectMeta.UID)
+	deviceIDs := []string{}
+	for _, entry := range cp.Data.PodDeviceEntries {
+		if entry.PodUID == podIDStr && entry.ContainerName == containerName && entry.ResourceName == resourceName {
+			deviceIDs = append(deviceIDs, entry.DeviceIDs...)
+		}
+	}
+	return deviceIDs, nil
+}
+
+func (client *Client) getAllocatedDeviceIDsFromCheckpoint() (map[string][]string, error) {
+	cp, err := client.readCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	allocatedDeviceIDs := map[string][]string{}
+	for _, entry := range cp.Data.PodDeviceEntries {
+		allocatedDeviceIDs[entry.ResourceName] = append(allocatedDeviceIDs[entry.ResourceName], entry.DeviceIDs...)
+	}
+	return allocatedDeviceIDs, nil
+}
+
+func (client *Client) readCheckpoint() (checkpoint.File, error) {
+	var cp checkpoint.File
+	buf, err := ioutil.ReadFile(client.checkpointFile)
+	if err != nil {
+		return cp, fmt.Errorf("kubelet checkpoint file could not be accessed because: %s", err)
+	}
+	if err = json.Unmarshal(buf, &cp); err != nil {
+		//K8s 1.21 changed internal file structure, so let's try that too before returning with error
+		var newCpFile checkpoint.NewFile
+		if err = json.Unmarshal(buf, &newCpFile); err != nil {
+			return cp, fmt.Errorf("kubelet checkpoint file could not be unmarshalled because: %s", err)
+		}
+		cp = checkpoint.TranslateNewCheckpointToOld(newCpFile)
+	}
+	return cp, nil
+}
@@ -0,0 +1,32 @@
+package podresources
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsGetUnsupported(t *testing.T) {
+	var tcs = []struct {
+		name        string
+		err         error
+		unsupported bool
+	}{
+		{"unimplemented", status.Error(codes.Unimplemented, "unknown method Get for service v1.PodResourcesLister"), true},
+		{"feature_gate_disabled", status.Error(codes.Unknown, kubeletGetDisabledMessage), true},
+		{"unknown_pod", status.Error(codes.Unknown, "pod test not found in namespace default"), false},
+		{"message_of_other_code", status.Error(codes.Internal, kubeletGetDisabledMessage), false},
+		{"kubelet_restarting", status.Error(codes.Unavailable, "connection refused"), false},
+		{"deadline_exceeded", status.Error(codes.DeadlineExceeded, "context deadline exceeded"), false},
+		{"not_a_status", errors.New(kubeletGetDisabledMessage), true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if unsupported := isGetUnsupported(tc.err); unsupported != tc.unsupported {
+				t.Errorf("Error: %v reported as unsupported Get: %t, expected: %t", tc.err, unsupported, tc.unsupported)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package sethandler
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/topology"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+//describeAppliedCpuset creates the entry of the applied cpusets annotation for a container provisioned with the provided cpuset
+func (setHandler *SetHandler) describeAppliedCpuset(container v1.Container, cpus cpuset.CPUSet) types.ContainerCpuset {
+	poolConfig := setHandler.getPoolConfig()
+	appliedCpuset := types.ContainerCpuset{
+		Name:      container.Name,
+		Cpuset:    cpus.String(),
+		Pools:     []string{},
+		NUMANodes: topology.GetNUMANodesOfCPUSet(cpus, setHandler.numaTopology).String(),
+		Timestamp: time.Now().UTC(),
+	}
+	for resourceName := range container.Resources.Requests {
+		resNameAsString := string(resourceName)
+		if !strings.HasPrefix(resNameAsString, resourceBaseName+"/") {
+			continue
+		}
+		poolName := strings.TrimPrefix(resNameAsString, resourceBaseName+"/")
+		appliedCpuset.Pools = append(appliedCpuset.Pools, poolName)
+		if types.DeterminePoolType(poolName) == types.ExclusivePoolID {
+			appliedCpuset.HTPolicy = poolConfig.SelectPool(poolName).HTPolicy
+		}
+	}
+	if len(appliedCpuset.Pools) == 0 {
+		appliedCpuset.Pools = append(appliedCpuset.Pools, types.DefaultPoolID)
+	}
+	sort.Strings(appliedCpuset.Pools)
+	return appliedCpuset
+}
+
+//getAppliedCpusets returns the content of the applied cpusets annotation of the Pod, or an empty annotation if it is missing or invalid
+func getAppliedCpusets(pod v1.Pod) types.CpusetAnnotation {
+	annotation, exists := pod.ObjectMeta.Annotations[types.CpusetAnnotationKey]
+	if !exists {
+		return types.CpusetAnnotation{}
+	}
+	appliedCpusets, err := types.DecodeCpusetAnnotation([]byte(annotation))
+	if err != nil {
+		log.Println("WARNING: Applied cpusets annotation of Pod:" + pod.ObjectMeta.Name + " ID:" + string(pod.ObjectMeta.UID) + " is invalid and will be overwritten, because:" + err.Error())
+		return types.CpusetAnnotation{}
+	}
+	return appliedCpusets
+}
+
+//publishAppliedCpusets updates the entries of the provided containers in the applied cpusets annotation of the Pod, together with any other annotations passed
+//The annotation is always updated on the latest version of the Pod read from the API, as the worker and the reconciler can update the same Pod concurrently,
+// and the cached copy of the Pod might not contain the entries the other one published
+func (setHandler *SetHandler) publishAppliedCpusets(pod v1.Pod, containers []types.ContainerCpuset, annotations map[string]string) error {
+	podClient := setHandler.k8sClient.CoreV1().Pods(pod.ObjectMeta.Namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		currentPod, err := podClient.Get(context.TODO(), pod.ObjectMeta.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		appliedCpusets, err := getAppliedCpusets(*currentPod).Update(containers...).Encode()
+		if err != nil {
+			return err
+		}
+		if currentPod.ObjectMeta.Annotations == nil {
+			currentPod.ObjectMeta.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			currentPod.ObjectMeta.Annotations[key] = value
+		}
+		currentPod.ObjectMeta.Annotations[types.CpusetAnnotationKey] = appliedCpusets
+		//The resourceVersion of the read Pod makes the API server reject the update if anyone changed the Pod in the meantime
+		_, err = podClient.Update(context.TODO(), currentPod, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,46 @@
+package sethandler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPublishAppliedCpusetsRetriesOnConflict(t *testing.T) {
+	reconcilerEntry, _ := types.CpusetAnnotation{{Name: "shared", Cpuset: "2-3"}}.Encode()
+	apiPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "conflict", Namespace: "default", Annotations: map[string]string{types.CpusetAnnotationKey: reconcilerEntry}}}
+	k8sClient := fake.NewSimpleClientset(&apiPod)
+	conflicts := 0
+	k8sClient.PrependReactor("update", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, apierrors.NewConflict(v1.Resource("pods"), apiPod.ObjectMeta.Name, nil)
+		}
+		return false, nil, nil
+	})
+	setHandler := SetHandler{k8sClient: k8sClient}
+	//The Pod handed over by the informer does not know about the entry of the reconciler yet
+	cachedPod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "conflict", Namespace: "default"}}
+	err := setHandler.publishAppliedCpusets(cachedPod, []types.ContainerCpuset{{Name: "default", Cpuset: "0-1"}}, map[string]string{setterAnnotationKey: "true"})
+	if err != nil || conflicts != 1 {
+		t.Fatalf("Applied cpusets were not published after a conflict, conflicts: %d, error: %v", conflicts, err)
+	}
+	publishedPod, err := k8sClient.CoreV1().Pods("default").Get(context.TODO(), "conflict", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Published Pod could not be read: %s", err.Error())
+	}
+	appliedCpusets, err := types.DecodeCpusetAnnotation([]byte(publishedPod.ObjectMeta.Annotations[types.CpusetAnnotationKey]))
+	if err != nil || len(appliedCpusets) != 2 {
+		t.Errorf("Entries of both containers should be published, got: %+v, error: %v", appliedCpusets, err)
+	}
+	if publishedPod.ObjectMeta.Annotations[setterAnnotationKey] != "true" {
+		t.Errorf("Additional annotations were not published, got: %v", publishedPod.ObjectMeta.Annotations)
+	}
+}
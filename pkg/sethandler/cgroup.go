@@ -0,0 +1,197 @@
+package sethandler
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+const (
+	//CgroupV1 denotes the legacy cgroup hierarchy, where the cpuset controller is mounted on its own
+	CgroupV1 = 1
+	//CgroupV2 denotes the unified cgroup hierarchy, where all controllers share the same tree
+	CgroupV2 = 2
+)
+
+var (
+	cpusFile           = "cpuset.cpus"
+	effectiveCpusFile  = "cpuset.cpus.effective"
+	memsFile           = "cpuset.mems"
+	effectiveMemsFile  = "cpuset.mems.effective"
+	controllersFile    = "cgroup.controllers"
+	subtreeControlFile = "cgroup.subtree_control"
+	cpusetController   = "cpuset"
+	systemdScopeSuffix = ".scope"
+	crioCgroupPrefix   = "crio-"
+	crioConmonPrefix   = "crio-conmon-"
+)
+
+//DetectCgroupVersion inspects the cgroupfs hierarchy mounted under the provided path, and returns which cgroup version it belongs to
+//The filesystem type decides when the path is a real cgroupfs mount, otherwise the existence of the v2 only cgroup.controllers file does
+func DetectCgroupVersion(cgroupRoot string) int {
+	var fsStat unix.Statfs_t
+	if err := unix.Statfs(cgroupRoot, &fsStat); err == nil {
+		switch int64(fsStat.Type) {
+		case unix.CGROUP2_SUPER_MAGIC:
+			return CgroupV2
+		case unix.CGROUP_SUPER_MAGIC:
+			return CgroupV1
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cgroupRoot, controllersFile)); err == nil {
+		return CgroupV2
+	}
+	return CgroupV1
+}
+
+//writeCpuset provisions the provided set into the cpuset.cpus file of the cgroup
+//On the unified hierarchy the cpuset controller is first delegated down to the cgroup, otherwise the file does not even exist
+func (setHandler *SetHandler) writeCpuset(cgroupPath string, cpus cpuset.CPUSet) error {
+	return setHandler.writeCpusetFile(cgroupPath, cpusFile, cpus)
+}
+
+//writeMems provisions the provided set of NUMA nodes into the cpuset.mems file of the cgroup
+func (setHandler *SetHandler) writeMems(cgroupPath string, mems cpuset.CPUSet) error {
+	return setHandler.writeCpusetFile(cgroupPath, memsFile, mems)
+}
+
+func (setHandler *SetHandler) writeCpusetFile(cgroupPath string, fileName string, set cpuset.CPUSet) error {
+	if setHandler.cgroupVersion == CgroupV2 {
+		err := setHandler.delegateCpusetController(cgroupPath)
+		if err != nil {
+			return errors.New("cpuset controller could not be enabled for cgroup:" + cgroupPath + " because:" + err.Error())
+		}
+	}
+	return os.WriteFile(filepath.Join(cgroupPath, fileName), []byte(set.String()), 0755)
+}
+
+//readCpuset returns the cpuset the processes of the cgroup are actually allowed to run on
+//On the unified hierarchy an empty cpuset.cpus means the cgroup inherits its parent's set, so the effective set is read instead
+func (setHandler *SetHandler) readCpuset(cgroupPath string) (cpuset.CPUSet, error) {
+	return setHandler.readEffectiveCpusetFile(cgroupPath, cpusFile, effectiveCpusFile)
+}
+
+//readMems returns the NUMA nodes the processes of the cgroup are actually allowed to allocate memory from
+func (setHandler *SetHandler) readMems(cgroupPath string) (cpuset.CPUSet, error) {
+	return setHandler.readEffectiveCpusetFile(cgroupPath, memsFile, effectiveMemsFile)
+}
+
+func (setHandler *SetHandler) readEffectiveCpusetFile(cgroupPath string, fileName string, effectiveFileName string) (cpuset.CPUSet, error) {
+	if setHandler.cgroupVersion == CgroupV2 {
+		effectiveSet, err := readCpusetFile(filepath.Join(cgroupPath, effectiveFileName))
+		if err == nil && !effectiveSet.IsEmpty() {
+			return effectiveSet, nil
+		}
+	}
+	return readCpusetFile(filepath.Join(cgroupPath, fileName))
+}
+
+func readCpusetFile(cpusetFilePath string) (cpuset.CPUSet, error) {
+	cpusetBytes, err := ioutil.ReadFile(cpusetFilePath)
+	if err != nil {
+		return cpuset.CPUSet{}, err
+	}
+	return cpuset.Parse(strings.TrimSpace(string(cpusetBytes)))
+}
+
+//delegateCpusetController enables the cpuset controller in the cgroup.subtree_control file of every ancestor of the cgroup, starting from cpusetRoot
+func (setHandler *SetHandler) delegateCpusetController(cgroupPath string) error {
+	ancestors := []string{}
+	for parent := filepath.Dir(cgroupPath); strings.HasPrefix(parent, setHandler.cpusetRoot); parent = filepath.Dir(parent) {
+		ancestors = append([]string{parent}, ancestors...)
+		if parent == setHandler.cpusetRoot {
+			break
+		}
+	}
+	for _, ancestor := range ancestors {
+		subtreeControlPath := filepath.Join(ancestor, subtreeControlFile)
+		enabledControllers, err := ioutil.ReadFile(subtreeControlPath)
+		if err != nil {
+			return err
+		}
+		if isControllerEnabled(string(enabledControllers), cpusetController) {
+			continue
+		}
+		err = os.WriteFile(subtreeControlPath, []byte("+"+cpusetController), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isControllerEnabled(controllers string, controller string) bool {
+	for _, enabledController := range strings.Fields(controllers) {
+		if enabledController == controller {
+			return true
+		}
+	}
+	return false
+}
+
+//cgroupBelongsToContainer tells whether a cgroup directory is the cgroup of the container with the provided ID
+//With the cgroupfs driver the directory is named after the ID, except for CRI-O which names it crio-<ID>,
+// while the systemd driver creates a <runtime prefix>-<ID>.scope for it (e.g. cri-containerd-<ID>.scope, crio-<ID>.scope)
+func cgroupBelongsToContainer(cgroupName string, containerID string) bool {
+	if isRuntimeHelperCgroup(cgroupName) {
+		return false
+	}
+	return cgroupName == containerID || cgroupName == crioCgroupPrefix+containerID || strings.HasSuffix(cgroupName, "-"+containerID+systemdScopeSuffix)
+}
+
+//cgroupPathBelongsToContainer tells whether a cgroup is, or is nested under the cgroup of the container with the provided ID
+func cgroupPathBelongsToContainer(cgroupPath string, containerID string) bool {
+	for _, cgroupName := range strings.Split(cgroupPath, string(filepath.Separator)) {
+		if cgroupBelongsToContainer(cgroupName, containerID) {
+			return true
+		}
+	}
+	return false
+}
+
+//isRuntimeHelperCgroup tells whether a cgroup belongs to a process of the container runtime, instead of a container
+//CRI-O puts the conmon monitor of every container into a separate crio-conmon-<ID>.scope next to the container's cgroup
+func isRuntimeHelperCgroup(cgroupName string) bool {
+	return strings.HasPrefix(cgroupName, crioConmonPrefix)
+}
+
+//getLeafCpusets returns all the cgroups under cpusetRoot which do not have any child cgroups
+//Cgroups of container runtime helper processes are not returned, as they belong to no container CPUSetter manages
+func (setHandler *SetHandler) getLeafCpusets() ([]string, error) {
+	return getLeafCgroups(setHandler.cpusetRoot)
+}
+
+//getLeafCgroups returns the cgroups under root, root included, which do not have any child cgroups, except the ones of runtime helper processes
+func getLeafCgroups(root string) ([]string, error) {
+	cgroupDirs := []string{}
+	hasChildren := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && isRuntimeHelperCgroup(entry.Name()) {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() {
+			cgroupDirs = append(cgroupDirs, path)
+			hasChildren[filepath.Dir(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	cpusetLeaves := []string{}
+	for _, cgroupDir := range cgroupDirs {
+		if !hasChildren[cgroupDir] {
+			cpusetLeaves = append(cpusetLeaves, cgroupDir)
+		}
+	}
+	return cpusetLeaves, nil
+}
@@ -0,0 +1,150 @@
+package sethandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/criclient"
+	"github.com/nokia/CPU-Pooler/pkg/topology"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"github.com/nokia/CPU-Pooler/test/utils"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func setupCgroupTest(t *testing.T, createFs func() (string, error)) *SetHandler {
+	if _, err := createFs(); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	t.Cleanup(func() {
+		if err := utils.RemoveTempSysFs(); err != nil {
+			t.Logf("Removal of temp fs for cpusets was unsuccessful due to: %s", err.Error())
+		}
+	})
+	//The topology of the host running the tests must never leak into the provisioned cpusets
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = dualSocketHTSysfs
+	t.Cleanup(func() { topology.SysfsRoot = originalRoot })
+	setHandler := &SetHandler{}
+	setHandler.SetSetHandler(types.PoolConfig{}, utils.GetCgroupRoot(), fake.NewSimpleClientset())
+	return setHandler
+}
+
+func TestDetectCgroupVersion(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	if setHandler.cgroupVersion != CgroupV1 {
+		t.Errorf("Legacy hierarchy detected as cgroup v%d", setHandler.cgroupVersion)
+	}
+	utils.RemoveTempSysFs()
+	setHandler = setupCgroupTest(t, utils.CreateTempSysFsV2)
+	if setHandler.cgroupVersion != CgroupV2 {
+		t.Errorf("Unified hierarchy detected as cgroup v%d", setHandler.cgroupVersion)
+	}
+}
+
+func TestWriteCpusetV2(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFsV2)
+	containerPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0002/cont02")
+	expectedSet, _ := cpuset.Parse("3-4")
+	if err := setHandler.writeCpuset(containerPath, expectedSet); err != nil {
+		t.Fatalf("Writing cpuset failed: %s", err.Error())
+	}
+	for _, ancestor := range []string{"", "besteffort", "besteffort/pod0002"} {
+		subtreeControl, _ := ioutil.ReadFile(filepath.Join(setHandler.cpusetRoot, ancestor, subtreeControlFile))
+		if string(subtreeControl) != "+cpuset" {
+			t.Errorf("cpuset controller was not delegated in: %s, subtree control: %s", ancestor, subtreeControl)
+		}
+	}
+	writtenSet, err := readCpusetFile(filepath.Join(containerPath, cpusFile))
+	if err != nil || !writtenSet.Equals(expectedSet) {
+		t.Errorf("Mismatch in expected (%s) vs actual (%s) cpus written in cpuset file", expectedSet, writtenSet)
+	}
+}
+
+func TestReadCpusetV2(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFsV2)
+	containerPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0001/cont01")
+	observedSet, err := setHandler.readCpuset(containerPath)
+	if err != nil || observedSet.String() != "0-79" {
+		t.Errorf("Inherited effective cpuset was not read, got: %s, error: %v", observedSet, err)
+	}
+}
+
+func TestGetLeafCpusets(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFsV2)
+	leaves, err := setHandler.getLeafCpusets()
+	if err != nil {
+		t.Fatalf("Leaf cpusets could not be listed: %s", err.Error())
+	}
+	if len(leaves) != 9 {
+		t.Errorf("Expected 9 container leaves, got: %v", leaves)
+	}
+	for _, leaf := range leaves {
+		if filepath.Base(filepath.Dir(leaf)) == "besteffort" {
+			t.Errorf("Pod level cgroup: %s reported as leaf", leaf)
+		}
+	}
+}
+
+func TestGetLeafCgroupsOfPod(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	leaves, err := getLeafCgroups(filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003"))
+	if err != nil {
+		t.Fatalf("Leaf cgroups of Pod could not be listed: %s", err.Error())
+	}
+	expectedLeaves := map[string]bool{"cont03a": true, "cont03b": true, "infrac3": true}
+	if len(leaves) != len(expectedLeaves) {
+		t.Errorf("Expected leaves: %v of the Pod only, got: %v", expectedLeaves, leaves)
+	}
+	for _, leaf := range leaves {
+		if !expectedLeaves[filepath.Base(leaf)] || filepath.Base(filepath.Dir(leaf)) != "pod0003" {
+			t.Errorf("Cgroup: %s does not belong to the listed Pod", leaf)
+		}
+	}
+	if _, err = getLeafCgroups(filepath.Join(setHandler.cpusetRoot, "besteffort/pod9999")); !os.IsNotExist(err) {
+		t.Errorf("Listing the leaves of a removed Pod cgroup should report it does not exist, got: %v", err)
+	}
+}
+
+func TestApplyCpusetThroughCRI(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{"default": {CPUset: cpuset.NewCPUSet(0, 1)}}})
+	socket := filepath.Join(t.TempDir(), "cri.sock")
+	//The runtime's container ID does not appear in cgroupfs, so the cgroup can only be found by asking the runtime
+	fakeServer, err := utils.StartFakeCRIServer(socket,
+		map[string]string{"runtimeid03a": "/kubepods/besteffort/pod0003/cont03a"},
+		map[string]utils.FakeSandbox{"sandbox3": {PodUID: "0003", CgroupPath: "/kubepods/besteffort/pod0003/infrac3"}})
+	if err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	defer fakeServer.Stop()
+	setHandler.SetCRIClient(criclient.NewClient(socket))
+	podMeta := metav1.ObjectMeta{Name: "cri", UID: "0003"}
+	if _, err = setHandler.applyCpusetToContainer(podMeta, "runtimeid03a", cpuset.NewCPUSet(2, 3), cpuset.NewCPUSet()); err != nil {
+		t.Fatalf("Cpuset of container could not be applied: %s", err.Error())
+	}
+	if err = setHandler.applyCpusetToInfraContainer(podMeta, v1.PodStatus{}, ""); err != nil {
+		t.Fatalf("Cpuset of infra container could not be applied: %s", err.Error())
+	}
+	expectedSets := map[string]string{"cont03a": "2-3", "infrac3": "0-1"}
+	for cgroup, expectedCpus := range expectedSets {
+		actualSet, err := readCpusetFile(filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003", cgroup, cpusFile))
+		if err != nil || actualSet.String() != expectedCpus {
+			t.Errorf("Cpuset of cgroup: %s was not set through CRI, expected: %s, actual: %s, error: %v", cgroup, expectedCpus, actualSet, err)
+		}
+	}
+	//A container the runtime cannot tell about is still found in cgroupfs
+	if _, err = setHandler.applyCpusetToContainer(podMeta, "cont03b", cpuset.NewCPUSet(4), cpuset.NewCPUSet()); err != nil {
+		t.Errorf("Cpuset of container unknown to the runtime was not applied through cgroupfs: %s", err.Error())
+	}
+	if actualSet, err := readCpusetFile(filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003/cont03b", cpusFile)); err != nil || actualSet.String() != "4" {
+		t.Errorf("Cpuset of cgroup: cont03b was not set through cgroupfs, actual: %s, error: %v", actualSet, err)
+	}
+	if _, err = setHandler.applyCpusetToContainer(podMeta, "unknown", cpuset.NewCPUSet(2, 3), cpuset.NewCPUSet()); err == nil {
+		t.Errorf("Cpuset of a container unknown to both the runtime and cgroupfs was applied")
+	}
+}
@@ -1,16 +1,15 @@
 package sethandler
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/nokia/CPU-Pooler/pkg/checkpoint"
-	"github.com/nokia/CPU-Pooler/pkg/k8sclient"
+	"github.com/fsnotify/fsnotify"
+	"github.com/nokia/CPU-Pooler/pkg/criclient"
+	"github.com/nokia/CPU-Pooler/pkg/podresources"
 	"github.com/nokia/CPU-Pooler/pkg/topology"
 	"github.com/nokia/CPU-Pooler/pkg/types"
 	"golang.org/x/sys/unix"
 	"io"
-	"io/ioutil"
 	"k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,20 +18,26 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
+	//ResyncPeriod controls how often all containers of the Node are reconciled, regardless of any cgroupfs events
+	ResyncPeriod = 60 * time.Second
+)
+
+var (
 	//MaxRetryCount controls how many times we re-try a remote API operation
 	MaxRetryCount = 150
 	//RetryInterval controls how much time (in milliseconds) we wait between two retry attempts when talking to a remote API
@@ -40,11 +45,10 @@ const (
 )
 
 var (
-	resourceBaseName       = "nokia.k8s.io"
-	processConfigKey       = resourceBaseName + "/cpus"
-	setterAnnotationSuffix = "cpusets-configured"
-	setterAnnotationKey    = resourceBaseName + "/" + setterAnnotationSuffix
-	containerPrefixList    = []string{"docker://", "containerd://"}
+	resourceBaseName    = "nokia.k8s.io"
+	processConfigKey    = resourceBaseName + "/cpus"
+	setterAnnotationKey = types.CpusetsConfiguredAnnotationKey
+	containerPrefixList = []string{"docker://", "containerd://", "cri-o://"}
 )
 
 type workItem struct {
@@ -54,13 +58,23 @@ type workItem struct {
 
 //SetHandler is the data set encapsulating the configuration data needed for the CPUSetter Controller to be able to adjust cpusets
 type SetHandler struct {
-	poolConfig      types.PoolConfig
+	poolConfig      atomic.Value
 	cpusetRoot      string
+	cgroupVersion   int
+	podResources    *podresources.Client
+	criClient       *criclient.Client
 	k8sClient       kubernetes.Interface
 	informerFactory informers.SharedInformerFactory
 	podSynced       cache.InformerSynced
+	podIndexer      cache.Indexer
 	workQueue       workqueue.Interface
+	cgroupWatcher   *fsnotify.Watcher
+	cgroupEvents    workqueue.RateLimitingInterface
 	stopChan        *chan struct{}
+	health          *healthState
+	eventRecorder   record.EventRecorder
+	numaTopology    map[int]int
+	htTopology      map[int]string
 }
 
 //SetHandler returns the SetHandler data set
@@ -69,16 +83,33 @@ func (setHandler SetHandler) SetHandler() SetHandler {
 }
 
 //SetSetHandler a setter for SetHandler
+//The cgroups of the containers are always discovered from cgroupfs, unless a CRI client is set separately with SetCRIClient
 func (setHandler *SetHandler) SetSetHandler(poolconf types.PoolConfig, cpusetRoot string, k8sClient kubernetes.Interface) {
-	setHandler.poolConfig = poolconf
+	setHandler.poolConfig.Store(poolconf)
 	setHandler.cpusetRoot = cpusetRoot
+	setHandler.cgroupVersion = DetectCgroupVersion(cpusetRoot)
+	setHandler.podResources = podresources.NewClient(podresources.DefaultSocket, podresources.DefaultCheckpointFile)
 	setHandler.k8sClient = k8sClient
-	setHandler.workQueue = workqueue.New()
+	setHandler.workQueue = workqueue.NewNamed(podQueueName)
+	setHandler.health = newHealthState()
+	setHandler.eventRecorder = newEventRecorder(k8sClient)
+	setHandler.discoverTopology()
+}
+
+//SetCRIClient sets the client SetHandler asks the container runtime with about the cgroups of the containers
+func (setHandler *SetHandler) SetCRIClient(criClient *criclient.Client) {
+	setHandler.criClient = criClient
+}
+
+//SetPodResourcesClient sets the client SetHandler reads the exclusive CPUs allocated to the containers with, instead of the one using the default kubelet socket
+func (setHandler *SetHandler) SetPodResourcesClient(podResources *podresources.Client) {
+	setHandler.podResources = podResources
 }
 
 //New creates a new SetHandler object
+//The cgroups of the containers are located through the CRI socket of the container runtime, or discovered from cgroupfs when the socket does not exist
 //Can return error if in-cluster K8s API server client could not be initialized
-func New(kubeConf string, poolConfig types.PoolConfig, cpusetRoot string) (*SetHandler, error) {
+func New(kubeConf string, poolConfig types.PoolConfig, cpusetRoot string, criSocket string) (*SetHandler, error) {
 	cfg, err := clientcmd.BuildConfigFromFlags("", kubeConf)
 	if err != nil {
 		return nil, err
@@ -89,23 +120,64 @@ func New(kubeConf string, poolConfig types.PoolConfig, cpusetRoot string) (*SetH
 	}
 	kubeInformerFactory := informers.NewSharedInformerFactory(kubeClient, time.Second)
 	podInformer := kubeInformerFactory.Core().V1().Pods().Informer()
+	err = podInformer.AddIndexers(cache.Indexers{podUIDIndex: indexPodByUID})
+	if err != nil {
+		return nil, err
+	}
+	cgroupVersion := DetectCgroupVersion(cpusetRoot)
+	log.Println("INFO: Detected cgroup v" + strconv.Itoa(cgroupVersion) + " hierarchy under: " + cpusetRoot)
 	setHandler := SetHandler{
-		poolConfig:      poolConfig,
 		cpusetRoot:      cpusetRoot,
+		cgroupVersion:   cgroupVersion,
+		podResources:    podresources.NewClient(podresources.DefaultSocket, podresources.DefaultCheckpointFile),
+		criClient:       criclient.NewClient(criSocket),
 		k8sClient:       kubeClient,
 		informerFactory: kubeInformerFactory,
 		podSynced:       podInformer.HasSynced,
-		workQueue:       workqueue.New(),
+		podIndexer:      podInformer.GetIndexer(),
+		workQueue:       workqueue.NewNamed(podQueueName),
+		health:          newHealthState(),
+		eventRecorder:   newEventRecorder(kubeClient),
 	}
 	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			setHandler.PodAdded((reflect.ValueOf(obj).Interface().(*v1.Pod)))
 		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			setHandler.PodUpdated(reflect.ValueOf(oldObj).Interface().(*v1.Pod), reflect.ValueOf(newObj).Interface().(*v1.Pod))
+		},
 	})
 	podInformer.SetWatchErrorHandler(setHandler.WatchErrorHandler)
+	setHandler.poolConfig.Store(poolConfig)
+	setHandler.discoverTopology()
 	return &setHandler, nil
 }
 
+//discoverTopology reads the NUMA and HT topology of the Node from sysfs once, so provisioning and reconciling the containers does not need to re-read it every time
+func (setHandler *SetHandler) discoverTopology() {
+	nodeTopology, err := topology.GetTopology()
+	if err != nil {
+		log.Println("ERROR: could not interrogate the CPU topology of the node from sysfs, because:" + err.Error())
+	}
+	setHandler.numaTopology = nodeTopology.NUMANodes()
+	setHandler.htTopology = nodeTopology.HTSiblings()
+}
+
+//UpdatePoolConfig replaces the pool configuration of the Node, and reconciles all the containers of the Node to their new cpusets
+func (setHandler *SetHandler) UpdatePoolConfig(poolConfig types.PoolConfig) {
+	setHandler.poolConfig.Store(poolConfig)
+	log.Println("INFO: Pool configuration updated, reconciling the cpusets of all containers")
+	err := setHandler.reconcileCpusets()
+	if err != nil {
+		log.Println("WARNING: Reconciliation after pool configuration update failed with error:" + err.Error())
+	}
+}
+
+func (setHandler *SetHandler) getPoolConfig() types.PoolConfig {
+	poolConfig, _ := setHandler.poolConfig.Load().(types.PoolConfig)
+	return poolConfig
+}
+
 //Run kicks the CPUSetter controller into motion, synchs it with the API server, and starts the desired number of asynch worker threads to handle the Pod API events
 func (setHandler *SetHandler) Run(threadiness int, stopCh *chan struct{}) error {
 	setHandler.stopChan = stopCh
@@ -120,6 +192,7 @@ func (setHandler *SetHandler) Run(threadiness int, stopCh *chan struct{}) error
 		go wait.Until(setHandler.runWorker, time.Second, *stopCh)
 	}
 	setHandler.StartReconciliation()
+	setHandler.health.setReady()
 	log.Println("INFO: CPUSetter is successfully initialized, worker threads are now serving requests!")
 	return nil
 }
@@ -130,6 +203,16 @@ func (setHandler *SetHandler) PodAdded(pod *v1.Pod) {
 	setHandler.workQueue.Add(workItem)
 }
 
+//PodUpdated handles UPDATE operations
+//Only updates bringing new running containers -i.e. started for the first time, or restarted with a new container ID- are queued, so the periodic resyncs of the informer cost nothing
+func (setHandler *SetHandler) PodUpdated(oldPod, newPod *v1.Pod) {
+	if len(gatherChangedContainers(oldPod, newPod)) == 0 {
+		return
+	}
+	workItem := workItem{oldPod: oldPod, newPod: newPod}
+	setHandler.workQueue.Add(workItem)
+}
+
 //WatchErrorHandler is an event handler invoked when the CPUSetter Controller's connection to the K8s API server breaks
 //In case the error is terminal it initiates a graceful shutdown for the whole Controller, implicitly restarting the connection by restarting the whole container
 func (setHandler *SetHandler) WatchErrorHandler(r *cache.Reflector, err error) {
@@ -150,15 +233,31 @@ func (setHandler *SetHandler) WatchErrorHandler(r *cache.Reflector, err error) {
 func (setHandler *SetHandler) Stop() {
 	*setHandler.stopChan <- struct{}{}
 	setHandler.workQueue.ShutDown()
+	setHandler.stopCgroupWatcher()
 }
 
-//StartReconciliation starts the reactive thread of SetHandler periodically checking expected and provisioned cpusets of the node
-//In case a container's observed cpuset differs from the expected (i.e. container was restarted) the thread resets it to the proper value
+//StartReconciliation starts the reactive threads of SetHandler checking expected and provisioned cpusets of the node
+//Containers are reconciled as soon as their cgroups are created or their cpusets are modified, while a slow periodic resync acts as a safety net for missed events
+//In case a container's observed cpuset differs from the expected (i.e. container was restarted) the threads reset it to the proper value
 func (setHandler *SetHandler) StartReconciliation() {
+	err := setHandler.startCgroupWatcher()
+	if err != nil {
+		log.Println("WARNING: cgroupfs events cannot be watched under: " + setHandler.cpusetRoot + " because:" + err.Error() + ", relying solely on periodic reconciliation")
+	} else {
+		go wait.Until(setHandler.runCgroupEventWorker, time.Second, *setHandler.stopChan)
+		log.Println("INFO: Successfully started the event driven cpuset reconciliation threads")
+	}
 	go setHandler.startReconciliationLoop()
 	log.Println("INFO: Successfully started the periodic cpuset reconciliation thread")
 }
 
+//ProcessQueuedPods handles all the Pod events queued so far in the calling thread, without starting the worker threads
+func (setHandler *SetHandler) ProcessQueuedPods() {
+	for setHandler.workQueue.Len() > 0 {
+		setHandler.processNextWorkItem()
+	}
+}
+
 func (setHandler *SetHandler) runWorker() {
 	for setHandler.processNextWorkItem() {
 	}
@@ -182,57 +281,52 @@ func (setHandler *SetHandler) processItemInQueue(obj interface{}) {
 		log.Println("WARNING: Cannot decode work item from queue in thread: " + strconv.Itoa(unix.Gettid()) + ", be aware that we are skipping some events!!!")
 		return
 	}
+	setHandler.health.startProcessing(item)
+	defer setHandler.health.finishProcessing(item)
 	setHandler.handlePods(item)
 }
 
 func (setHandler *SetHandler) handlePods(item workItem) {
-	isItMyPod, pod := shouldPodBeHandled(*item.newPod)
+	pod := *item.newPod
 	//The maze wasn't meant for you
-	if !isItMyPod {
+	if !shouldPodBeHandled(pod) {
 		return
 	}
-	containersToBeSet := gatherAllContainers(pod)
-	if len(containersToBeSet) > 0 {
-		var err error
-		for i := 0; i < MaxRetryCount; i++ {
-			err = setHandler.adjustContainerSets(pod, containersToBeSet)
-			if err == nil {
-				return
-			}
-			time.Sleep(RetryInterval * time.Millisecond)
+	//Containers which were already running with the same ID in the previous version of the Pod were provisioned by an earlier event
+	containersToBeSet := gatherChangedContainers(item.oldPod, item.newPod)
+	if len(containersToBeSet) == 0 {
+		//None of the containers are running yet, the UPDATE events of the Pod will bring them
+		return
+	}
+	var err error
+	for i := 0; i < MaxRetryCount; i++ {
+		if i > 0 {
+			cpusetAdjustmentRetries.Inc()
 		}
-		log.Println("ERROR: Timed out trying to adjust the cpusets of the containers belonging to Pod:" + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " because:" + err.Error())
-	} else {
-		log.Println("WARNING: there were no containers to handle in: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " in thread:" + strconv.Itoa(unix.Gettid()))
+		err = setHandler.adjustContainerSets(pod, containersToBeSet)
+		if err == nil {
+			cpusetAdjustments.WithLabelValues("success").Inc()
+			return
+		}
+		cpusetAdjustments.WithLabelValues("failure").Inc()
+		if i == 0 {
+			//Only the first failure is recorded, the retries would just flood the Pod with the same Event
+			setHandler.recordPodEvent(pod, v1.EventTypeWarning, cpusetAdjustmentFailedReason, "Cpusets of the containers could not be adjusted, retrying: "+err.Error())
+		}
+		time.Sleep(time.Duration(RetryInterval) * time.Millisecond)
 	}
+	cpusetAdjustmentTimeouts.Inc()
+	setHandler.recordPodEvent(pod, v1.EventTypeWarning, cpusetTimedOutReason, "Gave up adjusting the cpusets of the containers after "+strconv.Itoa(MaxRetryCount)+" attempts: "+err.Error())
+	log.Println("ERROR: Timed out trying to adjust the cpusets of the containers belonging to Pod:" + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " because:" + err.Error())
 }
 
-func shouldPodBeHandled(pod v1.Pod) (bool, v1.Pod) {
+func shouldPodBeHandled(pod v1.Pod) bool {
 	// Pod has exited/completed and all containers have stopped
 	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
-		return false, pod
-	}
-	setterNodeName := os.Getenv("NODE_NAME")
-	for i := 0; i < MaxRetryCount; i++ {
-		//We will unconditionally read the Pod at least once due to two reasons:
-		//1: 99% Chance that the Pod arriving in the CREATE event is not yet ready to be processed
-		//2: Avoid spending cycles on a Pod which does not even exist anymore in the API server
-		newPod, err := k8sclient.RefreshPod(pod)
-		if err != nil {
-			log.Println("WARNING: Pod:" + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " is not adjusted as reading it again failed with:" + err.Error())
-			return false, pod
-		}
-		if isPodReadyForProcessing(*newPod) {
-			pod = *newPod
-			break
-		}
-		time.Sleep(RetryInterval * time.Millisecond)
+		return false
 	}
 	//Pod is still haven't been scheduled, or it wasn't scheduled to the Node of this specific CPUSetter instance
-	if setterNodeName != pod.Spec.NodeName {
-		return false, pod
-	}
-	return true, pod
+	return pod.Spec.NodeName != "" && pod.Spec.NodeName == os.Getenv("NODE_NAME")
 }
 
 func isPodReadyForProcessing(pod v1.Pod) bool {
@@ -248,27 +342,58 @@ func isPodReadyForProcessing(pod v1.Pod) bool {
 	return true
 }
 
-func gatherAllContainers(pod v1.Pod) map[string]int {
-	workingContainers := map[string]int{}
-	for _, containerStatus := range pod.Status.ContainerStatuses {
-		if containerStatus.ContainerID == "" {
-			return map[string]int{}
+//areAllContainersRunning tells whether every container of the Pod is up, i.e. the Pod is provisioned once all of them are
+func areAllContainersRunning(pod v1.Pod) bool {
+	if len(pod.Status.ContainerStatuses) != len(pod.Spec.Containers) {
+		return false
+	}
+	for _, cStatus := range pod.Status.ContainerStatuses {
+		if !isContainerRunning(cStatus) {
+			return false
+		}
+	}
+	return true
+}
+
+func isContainerRunning(cStatus v1.ContainerStatus) bool {
+	return cStatus.ContainerID != "" && cStatus.State.Running != nil
+}
+
+//gatherChangedContainers returns the running containers of the new Pod which were not running with the same container ID in the old one
+//Without an old Pod (i.e. ADD events) all running containers are returned
+func gatherChangedContainers(oldPod, newPod *v1.Pod) map[string]int {
+	changedContainers := map[string]int{}
+	oldStatuses := map[string]v1.ContainerStatus{}
+	if oldPod != nil {
+		for _, cStatus := range oldPod.Status.ContainerStatuses {
+			oldStatuses[cStatus.Name] = cStatus
 		}
-		workingContainers[containerStatus.Name] = 0
 	}
-	return workingContainers
+	for _, cStatus := range newPod.Status.ContainerStatuses {
+		if !isContainerRunning(cStatus) {
+			continue
+		}
+		oldStatus, exists := oldStatuses[cStatus.Name]
+		if exists && isContainerRunning(oldStatus) && oldStatus.ContainerID == cStatus.ContainerID {
+			continue
+		}
+		changedContainers[cStatus.Name] = 0
+	}
+	return changedContainers
 }
 
 func (setHandler *SetHandler) adjustContainerSets(pod v1.Pod, containersToBeSet map[string]int) error {
 	var (
 		pathToContainerCpusetFile string
 		err                       error
+		appliedCpusets            = []types.ContainerCpuset{}
+		unallocatedPools          = map[string][]string{}
 	)
 	for _, container := range pod.Spec.Containers {
 		if _, found := containersToBeSet[container.Name]; !found {
 			continue
 		}
-		cpuset, err := setHandler.determineCorrectCpuset(pod, container)
+		cpuset, emptyExclusivePools, err := setHandler.determineCorrectCpuset(pod, container)
 		if err != nil {
 			return errors.New("correct cpuset for the containers of Pod: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " could not be calculated in thread:" + strconv.Itoa(unix.Gettid()) + " because:" + err.Error())
 		}
@@ -276,75 +401,122 @@ func (setHandler *SetHandler) adjustContainerSets(pod v1.Pod, containersToBeSet
 		if containerID == "" {
 			return errors.New("cannot determine container ID of container: " + container.Name + " in Pod: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " in thread:" + strconv.Itoa(unix.Gettid()) + " because:" + err.Error())
 		}
-		pathToContainerCpusetFile, err = setHandler.applyCpusetToContainer(pod.ObjectMeta, containerID, cpuset)
+		mems := setHandler.determineCorrectMems(container, cpuset)
+		pathToContainerCpusetFile, err = setHandler.applyCpusetToContainer(pod.ObjectMeta, containerID, cpuset, mems)
 		if err != nil {
 			return errors.New("cpuset of container: " + container.Name + " in Pod: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " could not be re-adjusted in thread:" + strconv.Itoa(unix.Gettid()) + " because:" + err.Error())
 		}
+		appliedCpusets = append(appliedCpusets, setHandler.describeAppliedCpuset(container, cpuset))
+		if len(emptyExclusivePools) > 0 {
+			unallocatedPools[container.Name] = emptyExclusivePools
+		}
 	}
-	err = setHandler.applyCpusetToInfraContainer(pod.ObjectMeta, pod.Status, pathToContainerCpusetFile)
-	if err != nil {
-		return errors.New("cpuset of the infra container in Pod: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " could not be re-adjusted in thread:" + strconv.Itoa(unix.Gettid()) + " because:" + err.Error())
+	//The infra container can only be told apart from the workload containers once all of their IDs are known
+	if isPodReadyForProcessing(pod) {
+		err = setHandler.applyCpusetToInfraContainer(pod.ObjectMeta, pod.Status, pathToContainerCpusetFile)
+		if err != nil {
+			return errors.New("cpuset of the infra container in Pod: " + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + " could not be re-adjusted in thread:" + strconv.Itoa(unix.Gettid()) + " because:" + err.Error())
+		}
+	}
+	//Processes waiting for their cpusets are only released once the last container of the Pod was provisioned
+	annotations := map[string]string{}
+	if areAllContainersRunning(pod) {
+		annotations[setterAnnotationKey] = "true"
 	}
-	err = k8sclient.SetPodAnnotation(pod, setterAnnotationKey, "true")
+	err = setHandler.publishAppliedCpusets(pod, appliedCpusets, annotations)
 	if err != nil {
 		return errors.New("could not update annotation in Pod:" + pod.ObjectMeta.Name + " ID: " + string(pod.ObjectMeta.UID) + "  in thread:" + strconv.Itoa(unix.Gettid()) + " because: " + err.Error())
 	}
+	//Events are only recorded once the whole Pod is provisioned, so a failing attempt does not report the same containers again on every retry
+	for _, appliedCpuset := range appliedCpusets {
+		setHandler.recordPodEvent(pod, v1.EventTypeNormal, cpusetAppliedReason, "Cpuset of container: "+appliedCpuset.Name+" set to: "+appliedCpuset.Cpuset)
+		for _, exclusivePoolName := range unallocatedPools[appliedCpuset.Name] {
+			setHandler.recordPodEvent(pod, v1.EventTypeWarning, noExclusiveCPUsReason, "Container: "+appliedCpuset.Name+" asked for exclusive CPUs from: "+exclusivePoolName+", but was not allocated any, it keeps running on its default cpuset")
+		}
+	}
 	return nil
 }
 
-func (setHandler *SetHandler) determineCorrectCpuset(pod v1.Pod, container v1.Container) (cpuset.CPUSet, error) {
+//determineCorrectCpuset returns the cpuset the container should run on, and the exclusive resources it requested without being allocated any CPUs from
+func (setHandler *SetHandler) determineCorrectCpuset(pod v1.Pod, container v1.Container) (cpuset.CPUSet, []string, error) {
 	var (
 		sharedCPUSet, exclusiveCPUSet cpuset.CPUSet
+		emptyExclusivePools           []string
 		err                           error
 	)
 	for resourceName := range container.Resources.Requests {
 		resNameAsString := string(resourceName)
-		if strings.Contains(resNameAsString, resourceBaseName) && strings.Contains(resNameAsString, types.SharedPoolID) {
-			sharedCPUSet = setHandler.poolConfig.SelectPool(types.SharedPoolID).CPUset
-		} else if strings.Contains(resNameAsString, resourceBaseName) && strings.Contains(resNameAsString, types.ExclusivePoolID) {
+		if !strings.HasPrefix(resNameAsString, resourceBaseName+"/") {
+			continue
+		}
+		poolName := strings.TrimPrefix(resNameAsString, resourceBaseName+"/")
+		if types.DeterminePoolType(poolName) == types.SharedPoolID {
+			//Every shared pool is a separate resource, so the container's cpuset is determined by the pool it actually requested
+			sharedCPUSet = sharedCPUSet.Union(setHandler.getPoolConfig().SelectPool(poolName).CPUset)
+		} else if types.DeterminePoolType(poolName) == types.ExclusivePoolID {
 			exclusiveCPUSet, err = setHandler.getListOfAllocatedExclusiveCpus(resNameAsString, pod, container)
 			if err != nil {
-				return cpuset.CPUSet{}, err
+				return cpuset.CPUSet{}, nil, err
+			}
+			if exclusiveCPUSet.IsEmpty() {
+				emptyExclusivePools = append(emptyExclusivePools, resNameAsString)
 			}
-			fullResName := strings.Split(resNameAsString, "/")
-			exclusivePoolName := fullResName[1]
-			if setHandler.poolConfig.SelectPool(exclusivePoolName).HTPolicy == types.MultiThreadHTPolicy {
-				htMap := topology.GetHTTopology()
-				exclusiveCPUSet = topology.AddHTSiblingsToCPUSet(exclusiveCPUSet, htMap)
+			if setHandler.getPoolConfig().SelectPool(poolName).HTPolicy == types.MultiThreadHTPolicy {
+				exclusiveCPUSet = topology.AddHTSiblingsToCPUSet(exclusiveCPUSet, setHandler.htTopology)
 			}
 		}
 	}
 	if !sharedCPUSet.IsEmpty() || !exclusiveCPUSet.IsEmpty() {
-		return sharedCPUSet.Union(exclusiveCPUSet), nil
+		return sharedCPUSet.Union(exclusiveCPUSet), emptyExclusivePools, nil
+	}
+	return setHandler.getPoolConfig().SelectPool(types.DefaultPoolID).CPUset, emptyExclusivePools, nil
+}
+
+//determineCorrectMems returns the NUMA nodes hosting the provided cpuset, if any of the pools the CPUs of the container come from asks for NUMA local memory
+//An empty set is returned otherwise, in which case cpuset.mems of the container is left untouched
+func (setHandler *SetHandler) determineCorrectMems(container v1.Container, cpus cpuset.CPUSet) cpuset.CPUSet {
+	if cpus.IsEmpty() || !setHandler.isNUMALocalMemoryRequired(container) {
+		return cpuset.NewCPUSet()
+	}
+	return topology.GetNUMANodesOfCPUSet(cpus, setHandler.numaTopology)
+}
+
+func (setHandler *SetHandler) isNUMALocalMemoryRequired(container v1.Container) bool {
+	poolConfig := setHandler.getPoolConfig()
+	requestsPool := false
+	for resourceName := range container.Resources.Requests {
+		resNameAsString := string(resourceName)
+		if !strings.HasPrefix(resNameAsString, resourceBaseName+"/") {
+			continue
+		}
+		poolName := strings.TrimPrefix(resNameAsString, resourceBaseName+"/")
+		if types.DeterminePoolType(poolName) == types.DefaultPoolID {
+			continue
+		}
+		requestsPool = true
+		if poolConfig.SelectPool(poolName).NUMALocalMemory {
+			return true
+		}
+	}
+	return !requestsPool && poolConfig.SelectPool(types.DefaultPoolID).NUMALocalMemory
+}
+
+//getDefaultMems returns the NUMA nodes of the default pool if it asks for NUMA local memory, otherwise an empty set
+func (setHandler *SetHandler) getDefaultMems() cpuset.CPUSet {
+	defaultPool := setHandler.getPoolConfig().SelectPool(types.DefaultPoolID)
+	if !defaultPool.NUMALocalMemory {
+		return cpuset.NewCPUSet()
 	}
-	return setHandler.poolConfig.SelectPool(types.DefaultPoolID).CPUset, nil
+	return topology.GetNUMANodesOfCPUSet(defaultPool.CPUset, setHandler.numaTopology)
 }
 
 func (setHandler *SetHandler) getListOfAllocatedExclusiveCpus(exclusivePoolName string, pod v1.Pod, container v1.Container) (cpuset.CPUSet, error) {
-	checkpointFileName := "/var/lib/kubelet/device-plugins/kubelet_internal_checkpoint"
-	buf, err := ioutil.ReadFile(checkpointFileName)
+	deviceIDs, err := setHandler.podResources.GetContainerDeviceIDs(pod, container.Name, exclusivePoolName)
 	if err != nil {
-		log.Printf("Error reading file %s: Error: %v", checkpointFileName, err)
-		return cpuset.CPUSet{}, fmt.Errorf("kubelet checkpoint file could not be accessed because: %s", err)
-	}
-	var cp checkpoint.File
-	if err = json.Unmarshal(buf, &cp); err != nil {
-		//K8s 1.21 changed internal file structure, so let's try that too before returning with error
-		var newCpFile checkpoint.NewFile
-		if err = json.Unmarshal(buf, &newCpFile); err != nil {
-			log.Printf("error unmarshalling kubelet checkpoint file: %s", err)
-			return cpuset.CPUSet{}, err
-		}
-		cp = checkpoint.TranslateNewCheckpointToOld(newCpFile)
+		log.Printf("ERROR: Device allocations of container: %s in Pod: %s could not be read from kubelet because: %v", container.Name, string(pod.ObjectMeta.UID), err)
+		return cpuset.CPUSet{}, err
 	}
 	podIDStr := string(pod.ObjectMeta.UID)
-	deviceIDs := []string{}
-	for _, entry := range cp.Data.PodDeviceEntries {
-		if entry.PodUID == podIDStr && entry.ContainerName == container.Name &&
-			entry.ResourceName == exclusivePoolName {
-			deviceIDs = append(deviceIDs, entry.DeviceIDs...)
-		}
-	}
 	if len(deviceIDs) == 0 {
 		log.Printf("WARNING: Container: %s in Pod: %s asked for exclusive CPUs, but were not allocated any! Cannot adjust its default cpuset", container.Name, podIDStr)
 		return cpuset.CPUSet{}, nil
@@ -385,35 +557,22 @@ func trimContainerPrefix(contName string) string {
 func containerIDInPodStatus(podStatus v1.PodStatus, containerDirName string) bool {
 	for _, containerStatus := range podStatus.ContainerStatuses {
 		trimmedCid := trimContainerPrefix(containerStatus.ContainerID)
-		if strings.Contains(containerDirName, trimmedCid) {
+		if trimmedCid != "" && cgroupBelongsToContainer(containerDirName, trimmedCid) {
 			return true
 		}
 	}
 	return false
 }
 
-func (setHandler *SetHandler) applyCpusetToContainer(podMeta metav1.ObjectMeta, containerID string, cpuset cpuset.CPUSet) (string, error) {
+func (setHandler *SetHandler) applyCpusetToContainer(podMeta metav1.ObjectMeta, containerID string, cpuset cpuset.CPUSet, mems cpuset.CPUSet) (string, error) {
 	if cpuset.IsEmpty() {
 		//Nothing to set. We will leave the container running on the Kubernetes provisioned default cpuset
 		log.Println("WARNING: cpuset to set was quite empty for container:" + containerID + " in Pod:" + podMeta.Name + " ID:" + string(podMeta.UID) + " in thread:" + strconv.Itoa(unix.Gettid()) + ". I left it untouched.")
 		return "", nil
 	}
-	var pathToContainerCpusetFile string
-	err := filepath.Walk(setHandler.cpusetRoot, func(path string, f os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if strings.Contains(path, containerID) {
-			pathToContainerCpusetFile = path
-			return filepath.SkipDir
-		}
-		return nil
-	})
+	pathToContainerCpusetFile, err := setHandler.findContainerCgroup(containerID)
 	if err != nil {
-		return "", fmt.Errorf("%s cpuset path error: %s", containerID, err.Error())
-	}
-	if pathToContainerCpusetFile == "" {
-		return "", fmt.Errorf("cpuset file does not exist for container: %s under the provided cgroupfs hierarchy: %s", containerID, setHandler.cpusetRoot)
+		return "", err
 	}
 	returnContainerPath := pathToContainerCpusetFile
 	//And for our grand finale, we just "echo" the calculated cpuset to the cpuset cgroupfs "file" of the given container
@@ -430,13 +589,92 @@ func (setHandler *SetHandler) applyCpusetToContainer(podMeta metav1.ObjectMeta,
 	if err != nil {
 		return "", fmt.Errorf("%s child cpuset path error: %s", containerID, err.Error())
 	}
-	err = os.WriteFile(pathToContainerCpusetFile+"/cpuset.cpus", []byte(cpuset.String()), 0755)
+	err = setHandler.writeCpuset(pathToContainerCpusetFile, cpuset)
 	if err != nil {
 		return "", fmt.Errorf("can't modify cpuset file: %s for container: %s because: %s", pathToContainerCpusetFile, containerID, err)
 	}
+	if !mems.IsEmpty() {
+		err = setHandler.writeMems(pathToContainerCpusetFile, mems)
+		if err != nil {
+			return "", fmt.Errorf("can't modify cpuset.mems file: %s for container: %s because: %s", pathToContainerCpusetFile, containerID, err)
+		}
+	}
 	return returnContainerPath, nil
 }
 
+//findContainerCgroup returns the cgroup of a container under cpusetRoot
+//The container runtime is asked about it over CRI if its socket exists, otherwise, or if the runtime cannot tell,
+// the whole hierarchy is searched for a directory named after the container ID
+func (setHandler *SetHandler) findContainerCgroup(containerID string) (string, error) {
+	if setHandler.criClient.IsAvailable() {
+		cgroupPath, err := setHandler.criClient.GetContainerCgroupPath(containerID)
+		if err == nil {
+			cgroupPath, err = setHandler.resolveRuntimeCgroupPath(cgroupPath)
+		}
+		if err == nil {
+			return cgroupPath, nil
+		}
+		log.Println("WARNING: cgroup of container:" + containerID + " could not be determined over CRI, searching cgroupfs for it instead, because:" + err.Error())
+	}
+	var pathToContainerCpusetFile string
+	err := filepath.Walk(setHandler.cpusetRoot, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() && cgroupBelongsToContainer(f.Name(), containerID) {
+			pathToContainerCpusetFile = path
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s cpuset path error: %s", containerID, err.Error())
+	}
+	if pathToContainerCpusetFile == "" {
+		return "", fmt.Errorf("cpuset file does not exist for container: %s under the provided cgroupfs hierarchy: %s", containerID, setHandler.cpusetRoot)
+	}
+	return pathToContainerCpusetFile, nil
+}
+
+//findInfraContainerCgroup returns the cgroup of the sandbox of a Pod under cpusetRoot
+//Without CRI, or if the runtime cannot tell, the sandbox is the only directory next to the already found workload container not listed in the PodStatus
+func (setHandler *SetHandler) findInfraContainerCgroup(podMeta metav1.ObjectMeta, podStatus v1.PodStatus, pathToSearchContainer string) (string, error) {
+	if setHandler.criClient.IsAvailable() {
+		cgroupPath, err := setHandler.criClient.GetPodSandboxCgroupPath(string(podMeta.UID))
+		if err == nil {
+			cgroupPath, err = setHandler.resolveRuntimeCgroupPath(cgroupPath)
+		}
+		if err == nil {
+			return cgroupPath, nil
+		}
+		log.Println("WARNING: cgroup of the sandbox of Pod:" + podMeta.Name + " ID:" + string(podMeta.UID) + " could not be determined over CRI, searching cgroupfs for it instead, because:" + err.Error())
+	}
+	if pathToSearchContainer == "" {
+		return "", fmt.Errorf("container directory does not exists under the provided cgroupfs hierarchy: %s", setHandler.cpusetRoot)
+	}
+	pathToContainerCpusetFile := getInfraContainerPath(podStatus, pathToSearchContainer)
+	if pathToContainerCpusetFile == "" {
+		return "", fmt.Errorf("cpuset file does not exist for infra container under the provided cgroupfs hierarchy: %s", setHandler.cpusetRoot)
+	}
+	return pathToContainerCpusetFile, nil
+}
+
+//resolveRuntimeCgroupPath maps a cgroup path reported by the container runtime, relative to the root of the whole cgroupfs hierarchy, to a directory under cpusetRoot
+//cpusetRoot is expected to be the top level cgroup of the Kubernetes workloads (e.g. kubepods, or kubepods.slice), which the reported path has to go through
+func (setHandler *SetHandler) resolveRuntimeCgroupPath(cgroupPath string) (string, error) {
+	rootName := filepath.Base(setHandler.cpusetRoot)
+	cleanPath := filepath.Clean("/" + cgroupPath)
+	rootIndex := strings.Index(cleanPath+"/", "/"+rootName+"/")
+	if rootIndex < 0 {
+		return "", fmt.Errorf("cgroup: %s reported by the container runtime is not under the provided cgroupfs hierarchy: %s", cgroupPath, setHandler.cpusetRoot)
+	}
+	resolvedPath := filepath.Join(setHandler.cpusetRoot, strings.TrimPrefix(cleanPath[rootIndex:], "/"+rootName))
+	if _, err := os.Stat(resolvedPath); err != nil {
+		return "", fmt.Errorf("cgroup: %s reported by the container runtime cannot be accessed because: %s", resolvedPath, err)
+	}
+	return resolvedPath, nil
+}
+
 func getInfraContainerPath(podStatus v1.PodStatus, searchPath string) string {
 	var pathToInfraContainer string
 	filelist, _ := filepath.Glob(filepath.Dir(searchPath) + "/*")
@@ -445,7 +683,7 @@ func getInfraContainerPath(podStatus v1.PodStatus, searchPath string) string {
 		if err != nil {
 			continue
 		}
-		if fstat.IsDir() && !containerIDInPodStatus(podStatus, fstat.Name()) {
+		if fstat.IsDir() && !isRuntimeHelperCgroup(fstat.Name()) && !containerIDInPodStatus(podStatus, fstat.Name()) {
 			pathToInfraContainer = fpath
 		}
 	}
@@ -453,28 +691,31 @@ func getInfraContainerPath(podStatus v1.PodStatus, searchPath string) string {
 }
 
 func (setHandler *SetHandler) applyCpusetToInfraContainer(podMeta metav1.ObjectMeta, podStatus v1.PodStatus, pathToSearchContainer string) error {
-	cpuset := setHandler.poolConfig.SelectPool(types.DefaultPoolID).CPUset
+	cpuset := setHandler.getPoolConfig().SelectPool(types.DefaultPoolID).CPUset
 	if cpuset.IsEmpty() {
 		//Nothing to set. We will leave the container running on the Kubernetes provisioned default cpuset
 		log.Println("WARNING: DEFAULT cpuset to set was quite empty in Pod:" + podMeta.Name + " ID:" + string(podMeta.UID) + " in thread:" + strconv.Itoa(unix.Gettid()) + ". I left it untouched.")
 		return nil
 	}
-	if pathToSearchContainer == "" {
-		return fmt.Errorf("container directory does not exists under the provided cgroupfs hierarchy: %s", setHandler.cpusetRoot)
-	}
-	pathToContainerCpusetFile := getInfraContainerPath(podStatus, pathToSearchContainer)
-	if pathToContainerCpusetFile == "" {
-		return fmt.Errorf("cpuset file does not exist for infra container under the provided cgroupfs hierarchy: %s", setHandler.cpusetRoot)
+	pathToContainerCpusetFile, err := setHandler.findInfraContainerCgroup(podMeta, podStatus, pathToSearchContainer)
+	if err != nil {
+		return err
 	}
-	err := os.WriteFile(pathToContainerCpusetFile+"/cpuset.cpus", []byte(cpuset.String()), 0755)
+	err = setHandler.writeCpuset(pathToContainerCpusetFile, cpuset)
 	if err != nil {
 		return fmt.Errorf("can't modify cpuset file: %s for infra container: %s because: %s", pathToContainerCpusetFile, filepath.Base(pathToContainerCpusetFile), err)
 	}
+	if mems := setHandler.getDefaultMems(); !mems.IsEmpty() {
+		err = setHandler.writeMems(pathToContainerCpusetFile, mems)
+		if err != nil {
+			return fmt.Errorf("can't modify cpuset.mems file: %s for infra container: %s because: %s", pathToContainerCpusetFile, filepath.Base(pathToContainerCpusetFile), err)
+		}
+	}
 	return nil
 }
 
 func (setHandler *SetHandler) startReconciliationLoop() {
-	timeToReconcile := time.NewTicker(5 * time.Second)
+	timeToReconcile := time.NewTicker(ResyncPeriod)
 	for {
 		select {
 		case <-timeToReconcile.C:
@@ -492,60 +733,157 @@ func (setHandler *SetHandler) startReconciliationLoop() {
 }
 
 func (setHandler *SetHandler) reconcileCpusets() error {
-	pods, err := k8sclient.GetMyPods()
-	if pods == nil || err != nil {
-		return errors.New("couldn't List my Pods in the reconciliation loop because:" + err.Error())
+	defer observeReconciliation("node", time.Now())
+	if setHandler.podIndexer == nil {
+		return errors.New("Pod informer cache is not initialized")
 	}
 	leafCpusets, err := setHandler.getLeafCpusets()
 	if err != nil {
 		return errors.New("couldn't interrogate leaf cpusets from cgroupfs because:" + err.Error())
 	}
-	for _, pod := range pods.Items {
-		for _, container := range pod.Spec.Containers {
-			err = setHandler.reconcileContainer(leafCpusets, pod, container)
-			if err != nil {
-				log.Println("WARNING: Periodic reconciliation of container:" + container.Name + " of Pod:" + pod.ObjectMeta.Name + " in namespace:" + pod.ObjectMeta.Namespace + " failed with error:" + err.Error())
-			}
+	setterNodeName := os.Getenv("NODE_NAME")
+	for _, obj := range setHandler.podIndexer.List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.Spec.NodeName != setterNodeName {
+			continue
 		}
+		setHandler.reconcilePod(leafCpusets, *pod)
 	}
 	return nil
 }
 
-func (setHandler *SetHandler) getLeafCpusets() ([]string, error) {
-	stdOut, err := topology.ExecCommand(exec.Command("find", setHandler.cpusetRoot, "-type", "d", "-links", "2"))
+func (setHandler *SetHandler) reconcilePod(leafCpusets []string, pod v1.Pod) {
+	repairedCpusets := []types.ContainerCpuset{}
+	for _, container := range pod.Spec.Containers {
+		repairedSet, err := setHandler.reconcileContainer(leafCpusets, pod, container)
+		if err != nil {
+			log.Println("WARNING: Reconciliation of container:" + container.Name + " of Pod:" + pod.ObjectMeta.Name + " in namespace:" + pod.ObjectMeta.Namespace + " failed with error:" + err.Error())
+		}
+		if !repairedSet.IsEmpty() {
+			repairedCpusets = append(repairedCpusets, setHandler.describeAppliedCpuset(container, repairedSet))
+		}
+	}
+	err := setHandler.reconcileInfraContainer(leafCpusets, pod)
 	if err != nil {
-		return nil, err
+		log.Println("WARNING: Reconciliation of the infra container of Pod:" + pod.ObjectMeta.Name + " in namespace:" + pod.ObjectMeta.Namespace + " failed with error:" + err.Error())
+	}
+	if len(repairedCpusets) == 0 {
+		return
+	}
+	err = setHandler.publishAppliedCpusets(pod, repairedCpusets, nil)
+	if err != nil {
+		log.Println("WARNING: Applied cpusets annotation of Pod:" + pod.ObjectMeta.Name + " in namespace:" + pod.ObjectMeta.Namespace + " could not be refreshed because:" + err.Error())
 	}
-	cpusetLeaves := strings.Split(strings.TrimSuffix(stdOut, "\n"), "\n")
-	return cpusetLeaves, nil
 }
 
-//Naive approach: we can prob afford not building a tree from the cgroup paths if we only reconcile every couple of seconds
+//Naive approach: we can prob afford not building a tree from the cgroup paths as event driven reconciliation only looks at the leaves of one Pod
 //Can be further optimized on need
-func (setHandler *SetHandler) reconcileContainer(leafCpusets []string, pod v1.Pod, container v1.Container) error {
+//Returns the cpuset written to the container, or an empty set if its cpuset did not need to be repaired
+func (setHandler *SetHandler) reconcileContainer(leafCpusets []string, pod v1.Pod, container v1.Container) (cpuset.CPUSet, error) {
 	containerID := determineCid(pod.Status, container.Name)
 	if containerID == "" {
-		return nil
+		return cpuset.NewCPUSet(), nil
 	}
-	numOfCpus := runtime.NumCPU()
-	badCpuset, _ := cpuset.Parse("0-" + strconv.Itoa(numOfCpus-1))
 	for _, leaf := range leafCpusets {
-		if strings.Contains(leaf, containerID) {
-			currentCpusetByte, _ := ioutil.ReadFile(leaf + "/cpuset.cpus")
-			currentCpusetStr := strings.TrimSpace(string(currentCpusetByte))
-			currentCpuset, _ := cpuset.Parse(currentCpusetStr)
-			if badCpuset.Equals(currentCpuset) {
-				correctSet, err := setHandler.determineCorrectCpuset(pod, container)
-				if err != nil {
-					return errors.New("could not determine correct cpuset because:" + err.Error())
-				}
-				err = os.WriteFile(leaf+"/cpuset.cpus", []byte(correctSet.String()), 0755)
-				if err != nil {
-					return errors.New("could not overwrite cpuset file:" + leaf + "/cpuset.cpus because:" + err.Error())
-				}
+		if cgroupPathBelongsToContainer(leaf, containerID) {
+			correctSet, _, err := setHandler.determineCorrectCpuset(pod, container)
+			if err != nil {
+				return cpuset.NewCPUSet(), errors.New("could not determine correct cpuset because:" + err.Error())
+			}
+			repaired, err := setHandler.repairCpusetDrift(leaf, "container:"+container.Name, pod, correctSet)
+			if err != nil {
+				return cpuset.NewCPUSet(), err
 			}
-			break
+			repairedSet := cpuset.NewCPUSet()
+			if repaired {
+				repairedSet = correctSet
+			}
+			return repairedSet, setHandler.repairMemsDrift(leaf, "container:"+container.Name, pod, setHandler.determineCorrectMems(container, correctSet))
 		}
 	}
+	return cpuset.NewCPUSet(), nil
+}
+
+//The infra container is the only leaf of a Pod not belonging to any of the containers listed in its status
+//Before all container IDs are known we cannot tell it apart from a freshly created workload container, so such Pods are skipped
+func (setHandler *SetHandler) reconcileInfraContainer(leafCpusets []string, pod v1.Pod) error {
+	if !isPodReadyForProcessing(pod) {
+		return nil
+	}
+	infraLeaves := []string{}
+	for _, leaf := range leafCpusets {
+		podUID, _ := podFromCgroupPath(setHandler.cpusetRoot, leaf)
+		if podUID == string(pod.ObjectMeta.UID) && !containerIDInPodStatus(pod.Status, filepath.Base(leaf)) {
+			infraLeaves = append(infraLeaves, leaf)
+		}
+	}
+	if len(infraLeaves) != 1 {
+		return nil
+	}
+	_, err := setHandler.repairCpusetDrift(infraLeaves[0], "infra container", pod, setHandler.getPoolConfig().SelectPool(types.DefaultPoolID).CPUset)
+	if err != nil {
+		return err
+	}
+	return setHandler.repairMemsDrift(infraLeaves[0], "infra container", pod, setHandler.getDefaultMems())
+}
+
+//repairCpusetDrift compares the observed cpuset of a cgroup with the expected one, and overwrites it in case they differ
+//Every repair is logged together with the observed and the expected sets, so unexpected modifications by other actors can be traced
+//Returns whether the cpuset had to be overwritten
+func (setHandler *SetHandler) repairCpusetDrift(cgroupPath string, owner string, pod v1.Pod, correctSet cpuset.CPUSet) (bool, error) {
+	if correctSet.IsEmpty() {
+		//Nothing to set. We leave the container running on the Kubernetes provisioned default cpuset, same as during provisioning
+		return false, nil
+	}
+	currentSet, err := setHandler.readCpuset(cgroupPath)
+	if err != nil {
+		return false, errors.New("could not read cpuset of cgroup:" + cgroupPath + " because:" + err.Error())
+	}
+	if currentSet.Equals(correctSet) {
+		return false, nil
+	}
+	err = setHandler.writeCpuset(cgroupPath, correctSet)
+	if err != nil {
+		return false, errors.New("could not overwrite cpuset file:" + cgroupPath + "/" + cpusFile + " because:" + err.Error())
+	}
+	driftRepairs.WithLabelValues(cpusFile).Inc()
+	log.Println("INFO: Repaired cpuset of " + owner + " in Pod:" + pod.ObjectMeta.Name + " ID:" + string(pod.ObjectMeta.UID) + " from:" + currentSet.String() + " to:" + correctSet.String() + " because:" + describeCpusetDrift(currentSet, correctSet))
+	setHandler.recordPodEvent(pod, v1.EventTypeNormal, cpusetRepairedReason, "Repaired cpuset of "+owner+" from: "+currentSet.String()+" to: "+correctSet.String()+" because: "+describeCpusetDrift(currentSet, correctSet))
+	return true, nil
+}
+
+//repairMemsDrift does the same for cpuset.mems, but only for cgroups whose pool asks for NUMA local memory
+func (setHandler *SetHandler) repairMemsDrift(cgroupPath string, owner string, pod v1.Pod, correctMems cpuset.CPUSet) error {
+	if correctMems.IsEmpty() {
+		return nil
+	}
+	currentMems, err := setHandler.readMems(cgroupPath)
+	if err != nil {
+		return errors.New("could not read cpuset.mems of cgroup:" + cgroupPath + " because:" + err.Error())
+	}
+	if currentMems.Equals(correctMems) {
+		return nil
+	}
+	err = setHandler.writeMems(cgroupPath, correctMems)
+	if err != nil {
+		return errors.New("could not overwrite cpuset file:" + cgroupPath + "/" + memsFile + " because:" + err.Error())
+	}
+	driftRepairs.WithLabelValues(memsFile).Inc()
+	log.Println("INFO: Repaired cpuset.mems of " + owner + " in Pod:" + pod.ObjectMeta.Name + " ID:" + string(pod.ObjectMeta.UID) + " from:" + currentMems.String() + " to:" + correctMems.String())
+	setHandler.recordPodEvent(pod, v1.EventTypeNormal, cpusetRepairedReason, "Repaired cpuset.mems of "+owner+" from: "+currentMems.String()+" to: "+correctMems.String())
 	return nil
 }
+
+func describeCpusetDrift(currentSet cpuset.CPUSet, correctSet cpuset.CPUSet) string {
+	allCpus, _ := cpuset.Parse("0-" + strconv.Itoa(runtime.NumCPU()-1))
+	if currentSet.Equals(allCpus) {
+		return "it was reset to all CPUs of the Node (e.g. container was restarted)"
+	}
+	if currentSet.IsEmpty() {
+		return "it was found empty"
+	}
+	if currentSet.IsSubsetOf(correctSet) {
+		return "CPUs " + correctSet.Difference(currentSet).String() + " were missing from it"
+	}
+	return "CPUs " + currentSet.Difference(correctSet).String() + " not belonging to its pool were present in it"
+}
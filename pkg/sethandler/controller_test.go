@@ -0,0 +1,398 @@
+package sethandler
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nokia/CPU-Pooler/pkg/podresources"
+	"github.com/nokia/CPU-Pooler/pkg/topology"
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"github.com/nokia/CPU-Pooler/test/utils"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+//The temporary cgroupfs changes the working directory of the tests, so the paths of the fixtures have to be resolved upfront
+var (
+	htNUMASysfs, _       = filepath.Abs("../../test/testdata/sysfs/ht-numa")
+	dualSocketHTSysfs, _ = filepath.Abs("../../test/testdata/sysfs/dual-socket-ht")
+)
+
+var driftTestPod = v1.Pod{
+	ObjectMeta: metav1.ObjectMeta{Name: "drift", UID: "0003"},
+	Spec: v1.PodSpec{
+		NodeName: "caas_master",
+		Containers: []v1.Container{
+			{Name: "shared", Resources: v1.ResourceRequirements{Requests: v1.ResourceList{"nokia.k8s.io/shared_caas": resource.MustParse("100")}}},
+			{Name: "default"},
+		},
+	},
+	Status: v1.PodStatus{
+		ContainerStatuses: []v1.ContainerStatus{
+			{Name: "shared", ContainerID: "docker://cont03a"},
+			{Name: "default", ContainerID: "containerd://cont03b"},
+		},
+	},
+}
+
+func TestReconcilePodRepairsDrift(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+		"default":     {CPUset: cpuset.NewCPUSet(0, 1)},
+		"shared_caas": {CPUset: cpuset.NewCPUSet(2, 3)},
+	}})
+	podPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003")
+	observedSets := map[string]string{"cont03a": "2,5-7", "cont03b": "0-1", "infrac3": "9"}
+	for cgroup, cpus := range observedSets {
+		if err := ioutil.WriteFile(filepath.Join(podPath, cgroup, cpusFile), []byte(cpus), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	leaves, err := setHandler.getLeafCpusets()
+	if err != nil {
+		t.Fatalf("Leaf cpusets could not be listed: %s", err.Error())
+	}
+	recorder := record.NewFakeRecorder(10)
+	setHandler.eventRecorder = recorder
+	if _, err = setHandler.k8sClient.CoreV1().Pods(driftTestPod.ObjectMeta.Namespace).Create(context.TODO(), &driftTestPod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	setHandler.reconcilePod(leaves, driftTestPod)
+	expectedSets := map[string]string{"cont03a": "2-3", "cont03b": "0-1", "infrac3": "0-1"}
+	for cgroup, expectedCpus := range expectedSets {
+		actualSet, err := readCpusetFile(filepath.Join(podPath, cgroup, cpusFile))
+		if err != nil || actualSet.String() != expectedCpus {
+			t.Errorf("Cpuset of cgroup: %s was not reconciled, expected: %s, actual: %s, error: %v", cgroup, expectedCpus, actualSet, err)
+		}
+	}
+	expectedEvents := []string{
+		"Normal CpusetRepaired Repaired cpuset of container:shared from: 2,5-7 to: 2-3 because: " + describeCpusetDrift(cpuset.MustParse("2,5-7"), cpuset.MustParse("2-3")),
+		"Normal CpusetRepaired Repaired cpuset of infra container from: 9 to: 0-1 because: " + describeCpusetDrift(cpuset.MustParse("9"), cpuset.MustParse("0-1")),
+	}
+	for _, expectedEvent := range expectedEvents {
+		select {
+		case event := <-recorder.Events:
+			if event != expectedEvent {
+				t.Errorf("Unexpected Event recorded, expected: %s, actual: %s", expectedEvent, event)
+			}
+		default:
+			t.Errorf("Expected Event was not recorded: %s", expectedEvent)
+		}
+	}
+	if len(recorder.Events) != 0 {
+		t.Errorf("Unexpected Event recorded for a container without drift: %s", <-recorder.Events)
+	}
+	reconciledPod, err := setHandler.k8sClient.CoreV1().Pods(driftTestPod.ObjectMeta.Namespace).Get(context.TODO(), driftTestPod.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Reconciled Pod could not be read: %s", err.Error())
+	}
+	appliedCpusets, err := types.DecodeCpusetAnnotation([]byte(reconciledPod.ObjectMeta.Annotations[types.CpusetAnnotationKey]))
+	if err != nil {
+		t.Fatalf("Applied cpusets annotation was not refreshed: %s", err.Error())
+	}
+	if len(appliedCpusets) != 1 || appliedCpusets[0].Name != "shared" || appliedCpusets[0].Cpuset != "2-3" || len(appliedCpusets[0].Pools) != 1 || appliedCpusets[0].Pools[0] != "shared_caas" {
+		t.Errorf("Applied cpusets annotation should only list the repaired container, got: %+v", appliedCpusets)
+	}
+}
+
+func TestReconcilePodRepairsMemsDrift(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = htNUMASysfs
+	defer func() { topology.SysfsRoot = originalRoot }()
+	setHandler.discoverTopology()
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+		"default":     {CPUset: cpuset.NewCPUSet(0, 1)},
+		"shared_caas": {CPUset: cpuset.NewCPUSet(2, 3), NUMALocalMemory: true},
+	}})
+	podPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003")
+	observedSets := map[string]string{"cont03a": "2-3", "cont03b": "0-1", "infrac3": "0-1"}
+	for cgroup, cpus := range observedSets {
+		if err := ioutil.WriteFile(filepath.Join(podPath, cgroup, cpusFile), []byte(cpus), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+		if err := ioutil.WriteFile(filepath.Join(podPath, cgroup, memsFile), []byte("0-1"), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	repairedMems := testutil.ToFloat64(driftRepairs.WithLabelValues(memsFile))
+	leaves, _ := setHandler.getLeafCpusets()
+	setHandler.reconcilePod(leaves, driftTestPod)
+	if repairs := testutil.ToFloat64(driftRepairs.WithLabelValues(memsFile)) - repairedMems; repairs != 1 {
+		t.Errorf("Expected 1 repaired cpuset.mems file to be counted, got: %v", repairs)
+	}
+	expectedMems := map[string]string{"cont03a": "1", "cont03b": "0-1", "infrac3": "0-1"}
+	for cgroup, expectedNodes := range expectedMems {
+		actualMems, err := readCpusetFile(filepath.Join(podPath, cgroup, memsFile))
+		if err != nil || actualMems.String() != expectedNodes {
+			t.Errorf("Cpuset.mems of cgroup: %s was not reconciled, expected: %s, actual: %s, error: %v", cgroup, expectedNodes, actualMems, err)
+		}
+	}
+}
+
+func TestTopologyIsDiscoveredOnce(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = htNUMASysfs
+	defer func() { topology.SysfsRoot = originalRoot }()
+	setHandler.discoverTopology()
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+		"shared_caas": {CPUset: cpuset.NewCPUSet(2, 3), NUMALocalMemory: true},
+	}})
+	//Sysfs is not read again when the cpusets of the containers are determined
+	topology.SysfsRoot = filepath.Join(t.TempDir(), "nonexisting")
+	if mems := setHandler.determineCorrectMems(driftTestPod.Spec.Containers[0], cpuset.NewCPUSet(2, 3)); mems.String() != "1" {
+		t.Errorf("NUMA nodes of the cpuset were not determined from the discovered topology, got: %s", mems)
+	}
+}
+
+func TestReconcilePodSkipsInfraContainerOfUnreadyPod(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{"default": {CPUset: cpuset.NewCPUSet(0, 1)}}})
+	podPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003")
+	for _, cgroup := range []string{"cont03a", "cont03b", "infrac3"} {
+		if err := ioutil.WriteFile(filepath.Join(podPath, cgroup, cpusFile), []byte("9"), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	unreadyPod := driftTestPod.DeepCopy()
+	unreadyPod.Status.ContainerStatuses[1].ContainerID = ""
+	leaves, _ := setHandler.getLeafCpusets()
+	err := setHandler.reconcileInfraContainer(leaves, *unreadyPod)
+	if err != nil {
+		t.Errorf("Reconciliation of infra container failed: %s", err.Error())
+	}
+	for _, cgroup := range []string{"cont03b", "infrac3"} {
+		actualSet, _ := readCpusetFile(filepath.Join(podPath, cgroup, cpusFile))
+		if actualSet.String() != "9" {
+			t.Errorf("Cgroup: %s of a not yet ready Pod was overwritten as an infra container to: %s", cgroup, actualSet)
+		}
+	}
+}
+
+func TestReconcilePodOnRuntimeCgroupLayouts(t *testing.T) {
+	crioPod := driftTestPod.DeepCopy()
+	crioPod.Status.ContainerStatuses[0].ContainerID = "cri-o://cont03a"
+	crioPod.Status.ContainerStatuses[1].ContainerID = "cri-o://cont03b"
+	var tcs = []struct {
+		name          string
+		createFs      func() (string, error)
+		pod           v1.Pod
+		podDir        string
+		expectedSets  map[string]string
+		untouchedSets []string
+		cont03aCgroup string
+	}{
+		{
+			name:          "containerd",
+			createFs:      utils.CreateTempSysFsSystemd,
+			pod:           driftTestPod,
+			podDir:        "kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice",
+			expectedSets:  map[string]string{"cri-containerd-cont03a.scope": "2-3", "cri-containerd-cont03b.scope": "0-1", "cri-containerd-infrac3.scope": "0-1"},
+			cont03aCgroup: "cri-containerd-cont03a.scope",
+		},
+		{
+			name:          "cri-o",
+			createFs:      utils.CreateTempSysFsCrio,
+			pod:           *crioPod,
+			podDir:        "kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice",
+			expectedSets:  map[string]string{"crio-cont03a.scope": "2-3", "crio-cont03b.scope": "0-1", "crio-infrac3.scope": "0-1"},
+			untouchedSets: []string{"crio-conmon-cont03a.scope", "crio-conmon-cont03b.scope", "crio-conmon-infrac3.scope"},
+			cont03aCgroup: "crio-cont03a.scope",
+		},
+		{
+			name:          "cri-o_cgroupfs",
+			createFs:      utils.CreateTempSysFsCrioCgroupfs,
+			pod:           *crioPod,
+			podDir:        "besteffort/pod0003",
+			expectedSets:  map[string]string{"crio-cont03a": "2-3", "crio-cont03b": "0-1", "crio-infrac3": "0-1"},
+			untouchedSets: []string{"crio-conmon-cont03a", "crio-conmon-cont03b", "crio-conmon-infrac3"},
+			cont03aCgroup: "crio-cont03a",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			setHandler := setupCgroupTest(t, tc.createFs)
+			setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+				"default":     {CPUset: cpuset.NewCPUSet(0, 1)},
+				"shared_caas": {CPUset: cpuset.NewCPUSet(2, 3)},
+			}})
+			podPath := filepath.Join(setHandler.cpusetRoot, tc.podDir)
+			cgroups, _ := filepath.Glob(filepath.Join(podPath, "*"))
+			for _, cgroup := range cgroups {
+				if err := ioutil.WriteFile(filepath.Join(cgroup, cpusFile), []byte("9"), 0644); err != nil {
+					t.Fatalf("Test suite setup failed: %s", err.Error())
+				}
+			}
+			leaves, err := setHandler.getLeafCpusets()
+			if err != nil {
+				t.Fatalf("Leaf cpusets could not be listed: %s", err.Error())
+			}
+			setHandler.reconcilePod(leaves, tc.pod)
+			for cgroup, expectedCpus := range tc.expectedSets {
+				actualSet, err := readCpusetFile(filepath.Join(podPath, cgroup, cpusFile))
+				if err != nil || actualSet.String() != expectedCpus {
+					t.Errorf("Cpuset of cgroup: %s was not reconciled, expected: %s, actual: %s, error: %v", cgroup, expectedCpus, actualSet, err)
+				}
+			}
+			for _, cgroup := range tc.untouchedSets {
+				actualSet, err := readCpusetFile(filepath.Join(podPath, cgroup, cpusFile))
+				if err != nil || actualSet.String() != "9" {
+					t.Errorf("Cpuset of runtime helper cgroup: %s was modified to: %s, error: %v", cgroup, actualSet, err)
+				}
+			}
+			containerPath, err := setHandler.applyCpusetToContainer(tc.pod.ObjectMeta, "cont03a", cpuset.NewCPUSet(5), cpuset.NewCPUSet())
+			if err != nil || containerPath != filepath.Join(podPath, tc.cont03aCgroup) {
+				t.Errorf("Cgroup of container was not found in cgroupfs, expected: %s, actual: %s, error: %v", tc.cont03aCgroup, containerPath, err)
+			}
+		})
+	}
+}
+
+func runningPod(pod v1.Pod, runningContainers ...string) *v1.Pod {
+	runningPod := pod.DeepCopy()
+	for i, cStatus := range runningPod.Status.ContainerStatuses {
+		runningPod.Status.ContainerStatuses[i].State = v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}
+		for _, name := range runningContainers {
+			if cStatus.Name == name {
+				runningPod.Status.ContainerStatuses[i].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+			}
+		}
+	}
+	return runningPod
+}
+
+func TestGatherChangedContainers(t *testing.T) {
+	restartedPod := runningPod(driftTestPod, "shared", "default")
+	restartedPod.Status.ContainerStatuses[0].ContainerID = "docker://cont03c"
+	var tcs = []struct {
+		name               string
+		oldPod             *v1.Pod
+		newPod             *v1.Pod
+		expectedContainers []string
+	}{
+		{name: "added", newPod: runningPod(driftTestPod, "shared", "default"), expectedContainers: []string{"shared", "default"}},
+		{name: "added_not_running", newPod: runningPod(driftTestPod), expectedContainers: []string{}},
+		{name: "late_starting", oldPod: runningPod(driftTestPod, "shared"), newPod: runningPod(driftTestPod, "shared", "default"), expectedContainers: []string{"default"}},
+		{name: "restarted", oldPod: runningPod(driftTestPod, "shared", "default"), newPod: restartedPod, expectedContainers: []string{"shared"}},
+		{name: "resync", oldPod: runningPod(driftTestPod, "shared", "default"), newPod: runningPod(driftTestPod, "shared", "default"), expectedContainers: []string{}},
+		{name: "stopped", oldPod: runningPod(driftTestPod, "shared", "default"), newPod: runningPod(driftTestPod, "default"), expectedContainers: []string{}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			changedContainers := gatherChangedContainers(tc.oldPod, tc.newPod)
+			if len(changedContainers) != len(tc.expectedContainers) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) changed containers", tc.expectedContainers, changedContainers)
+			}
+			for _, name := range tc.expectedContainers {
+				if _, found := changedContainers[name]; !found {
+					t.Errorf("Container: %s was not reported as changed, got: %v", name, changedContainers)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePodsProvisionsChangedContainers(t *testing.T) {
+	t.Setenv("NODE_NAME", "caas_master")
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	setHandler.eventRecorder = record.NewFakeRecorder(10)
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+		"default":     {CPUset: cpuset.NewCPUSet(0, 1)},
+		"shared_caas": {CPUset: cpuset.NewCPUSet(2, 3)},
+	}})
+	podPath := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0003")
+	for _, cgroup := range []string{"cont03a", "cont03b", "infrac3"} {
+		if err := ioutil.WriteFile(filepath.Join(podPath, cgroup, cpusFile), []byte("9"), 0644); err != nil {
+			t.Fatalf("Test suite setup failed: %s", err.Error())
+		}
+	}
+	//The entry published by the earlier event is only visible in the API, not in the cached Pod handled by the worker
+	publishedPod := driftTestPod.DeepCopy()
+	sharedEntry, _ := types.CpusetAnnotation{{Name: "shared", Cpuset: "9"}}.Encode()
+	publishedPod.ObjectMeta.Annotations = map[string]string{types.CpusetAnnotationKey: sharedEntry}
+	if _, err := setHandler.k8sClient.CoreV1().Pods(driftTestPod.ObjectMeta.Namespace).Create(context.TODO(), publishedPod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	setHandler.PodUpdated(runningPod(driftTestPod, "shared", "default"), runningPod(driftTestPod, "shared", "default"))
+	if setHandler.workQueue.Len() != 0 {
+		t.Errorf("Update without new running containers was queued")
+	}
+	//The shared container was provisioned by an earlier event, the late starting default container is provisioned together with the infra container
+	setHandler.handlePods(workItem{oldPod: runningPod(driftTestPod, "shared"), newPod: runningPod(driftTestPod, "shared", "default")})
+	expectedSets := map[string]string{"cont03a": "9", "cont03b": "0-1", "infrac3": "0-1"}
+	for cgroup, expectedCpus := range expectedSets {
+		actualSet, err := readCpusetFile(filepath.Join(podPath, cgroup, cpusFile))
+		if err != nil || actualSet.String() != expectedCpus {
+			t.Errorf("Cpuset of cgroup: %s was not provisioned as expected: %s, actual: %s, error: %v", cgroup, expectedCpus, actualSet, err)
+		}
+	}
+	provisionedPod, err := setHandler.k8sClient.CoreV1().Pods(driftTestPod.ObjectMeta.Namespace).Get(context.TODO(), driftTestPod.ObjectMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Provisioned Pod could not be read: %s", err.Error())
+	}
+	if provisionedPod.ObjectMeta.Annotations[setterAnnotationKey] != "true" {
+		t.Errorf("Pod was not marked as provisioned after its last container was started")
+	}
+	appliedCpusets, _ := types.DecodeCpusetAnnotation([]byte(provisionedPod.ObjectMeta.Annotations[types.CpusetAnnotationKey]))
+	if _, exists := appliedCpusets.Container("shared"); !exists || len(appliedCpusets) != 2 {
+		t.Errorf("Applied cpusets annotation should list the newly started container next to the earlier published one, got: %+v", appliedCpusets)
+	}
+	if defaultCpuset, exists := appliedCpusets.Container("default"); !exists || defaultCpuset.Cpuset != "0-1" {
+		t.Errorf("Applied cpuset of the newly started container was not published, got: %+v", appliedCpusets)
+	}
+}
+
+func TestNoExclusiveCPUsEventOnlyOnProvisioning(t *testing.T) {
+	t.Setenv("NODE_NAME", "caas_master")
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	recorder := record.NewFakeRecorder(10)
+	setHandler.eventRecorder = recorder
+	setHandler.poolConfig.Store(types.PoolConfig{Pools: map[string]types.Pool{
+		"default":        {CPUset: cpuset.NewCPUSet(0, 1)},
+		"exclusive_caas": {CPUset: cpuset.NewCPUSet(4, 5)},
+	}})
+	//Kubelet did not allocate any exclusive CPUs to the container
+	checkpointFile := filepath.Join(t.TempDir(), "kubelet_internal_checkpoint")
+	if err := ioutil.WriteFile(checkpointFile, []byte(`{"Data":{"PodDeviceEntries":[]}}`), 0644); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	setHandler.SetPodResourcesClient(podresources.NewClient(filepath.Join(t.TempDir(), "kubelet.sock"), checkpointFile))
+	pod := runningPod(driftTestPod, "shared", "default")
+	pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{"nokia.k8s.io/exclusive_caas": resource.MustParse("1")}
+	if _, err := setHandler.k8sClient.CoreV1().Pods(pod.ObjectMeta.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	leaves, _ := setHandler.getLeafCpusets()
+	for i := 0; i < 2; i++ {
+		setHandler.reconcilePod(leaves, *pod)
+	}
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, noExclusiveCPUsReason) {
+			t.Errorf("Reconciliation recorded Event: %s", event)
+		}
+	}
+	if err := setHandler.adjustContainerSets(*pod, map[string]int{"shared": 0}); err != nil {
+		t.Fatalf("Cpusets of the Pod could not be adjusted: %s", err.Error())
+	}
+	expectedEvent := "Warning " + noExclusiveCPUsReason + " Container: shared asked for exclusive CPUs from: nokia.k8s.io/exclusive_caas, but was not allocated any, it keeps running on its default cpuset"
+	warnings := 0
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.HasPrefix(event, "Warning") {
+			warnings++
+			if event != expectedEvent {
+				t.Errorf("Unexpected Event recorded, expected: %s, actual: %s", expectedEvent, event)
+			}
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("Expected one %s Event when provisioning the Pod, got: %d", noExclusiveCPUsReason, warnings)
+	}
+}
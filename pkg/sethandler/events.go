@@ -0,0 +1,38 @@
+package sethandler
+
+import (
+	"os"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	//eventComponent is the source of the Events recorded by CPUSetter
+	eventComponent = "cpu-setter"
+	//Reasons of the Events recorded on the Pods handled by CPUSetter
+	cpusetAppliedReason          = "CpusetApplied"
+	cpusetAdjustmentFailedReason = "CpusetAdjustmentFailed"
+	cpusetTimedOutReason         = "CpusetAdjustmentTimedOut"
+	noExclusiveCPUsReason        = "NoExclusiveCPUsAllocated"
+	cpusetRepairedReason         = "CpusetRepaired"
+)
+
+//newEventRecorder creates a recorder publishing the Events of CPUSetter through the provided K8s client
+//Events are sent asynchronously, so recording them never blocks the worker threads
+func newEventRecorder(k8sClient kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent, Host: os.Getenv("NODE_NAME")})
+}
+
+//recordPodEvent records an Event on the Pod, if the SetHandler has an event recorder
+func (setHandler *SetHandler) recordPodEvent(pod v1.Pod, eventType string, reason string, message string) {
+	if setHandler.eventRecorder == nil {
+		return
+	}
+	setHandler.eventRecorder.Event(&pod, eventType, reason, message)
+}
@@ -0,0 +1,65 @@
+package sethandler
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	//WorkerStuckThreshold controls how long a worker thread can process one Pod before CPUSetter is reported to be unhealthy
+	//Handling a Pod legitimately takes up to twice MaxRetryCount*RetryInterval: once waiting for the Pod to be ready, and once for its cpusets to be provisioned
+	WorkerStuckThreshold = 5 * time.Minute
+)
+
+//healthState tracks whether the controller finished its initialization, and the Pods its worker threads are processing at the moment
+type healthState struct {
+	lock       sync.Mutex
+	ready      bool
+	processing map[workItem]time.Time
+}
+
+func newHealthState() *healthState {
+	return &healthState{processing: make(map[workItem]time.Time)}
+}
+
+func (health *healthState) setReady() {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+	health.ready = true
+}
+
+func (health *healthState) startProcessing(item workItem) {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+	health.processing[item] = time.Now()
+}
+
+func (health *healthState) finishProcessing(item workItem) {
+	health.lock.Lock()
+	defer health.lock.Unlock()
+	delete(health.processing, item)
+}
+
+//Ready returns an error until the Pod cache of the controller is synced with the API server, and its worker threads are started
+func (setHandler *SetHandler) Ready() error {
+	setHandler.health.lock.Lock()
+	defer setHandler.health.lock.Unlock()
+	if !setHandler.health.ready {
+		return errors.New("Pod cache is not synced yet, worker threads are not started")
+	}
+	return nil
+}
+
+//Healthy returns an error if any of the worker threads is stuck processing the same Pod for longer than WorkerStuckThreshold
+func (setHandler *SetHandler) Healthy() error {
+	setHandler.health.lock.Lock()
+	defer setHandler.health.lock.Unlock()
+	for item, startTime := range setHandler.health.processing {
+		if processingTime := time.Since(startTime); processingTime > WorkerStuckThreshold {
+			return errors.New("a worker thread is stuck processing Pod:" + item.newPod.ObjectMeta.Name + " ID:" + string(item.newPod.ObjectMeta.UID) + " for " + strconv.Itoa(int(processingTime.Seconds())) + " seconds")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package sethandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/pkg/types"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHealthState(t *testing.T) {
+	setHandler := &SetHandler{}
+	setHandler.SetSetHandler(types.PoolConfig{}, "", fake.NewSimpleClientset())
+	if err := setHandler.Ready(); err == nil {
+		t.Errorf("SetHandler reported ready before its initialization finished")
+	}
+	setHandler.health.setReady()
+	if err := setHandler.Ready(); err != nil {
+		t.Errorf("SetHandler reported not ready after its initialization finished: %v", err)
+	}
+	item := workItem{newPod: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "stuck", UID: "0042"}}}
+	setHandler.health.startProcessing(item)
+	if err := setHandler.Healthy(); err != nil {
+		t.Errorf("SetHandler reported unhealthy while processing a Pod within the threshold: %v", err)
+	}
+	setHandler.health.processing[item] = time.Now().Add(-2 * WorkerStuckThreshold)
+	if err := setHandler.Healthy(); err == nil {
+		t.Errorf("SetHandler reported healthy while a worker thread is stuck")
+	}
+	setHandler.health.finishProcessing(item)
+	if err := setHandler.Healthy(); err != nil {
+		t.Errorf("SetHandler reported unhealthy after the stuck Pod was processed: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package sethandler
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	metricsNamespace = "cpu_pooler"
+	metricsSubsystem = "cpusetter"
+	//podQueueName and cgroupEventQueueName label the metrics of the work queues of SetHandler
+	podQueueName         = "pods"
+	cgroupEventQueueName = "cgroup_events"
+)
+
+var (
+	cpusetAdjustments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "cpuset_adjustments_total",
+		Help:      "Number of attempts to provision the cpusets of the containers of a Pod, by result.",
+	}, []string{"result"})
+	cpusetAdjustmentRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "cpuset_adjustment_retries_total",
+		Help:      "Number of times provisioning the cpusets of a Pod was retried after a failed attempt.",
+	})
+	cpusetAdjustmentTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "cpuset_adjustment_timeouts_total",
+		Help:      "Number of Pods whose cpusets could not be provisioned within MaxRetryCount attempts.",
+	})
+	reconciliationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "reconciliation_duration_seconds",
+		Help:      "Duration of cpuset reconciliations, either of one Pod after a cgroupfs event, or of the whole Node.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"scope"})
+	driftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "drift_repairs_total",
+		Help:      "Number of drifted cpuset files rewritten during reconciliation, by file.",
+	}, []string{"file"})
+
+	workQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_depth",
+		Help:      "Current number of items waiting in a work queue.",
+	}, []string{"queue"})
+	workQueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_adds_total",
+		Help:      "Number of items added to a work queue.",
+	}, []string{"queue"})
+	workQueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_queue_duration_seconds",
+		Help:      "Time an item spends in a work queue before being processed.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"queue"})
+	workQueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_work_duration_seconds",
+		Help:      "Time processing an item of a work queue takes.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"queue"})
+	workQueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_unfinished_work_seconds",
+		Help:      "Time the items of a work queue currently being processed have been in progress for.",
+	}, []string{"queue"})
+	workQueueLongestRunningProcessor = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_longest_running_processor_seconds",
+		Help:      "Time the longest running item of a work queue has been in progress for.",
+	}, []string{"queue"})
+	workQueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "workqueue_retries_total",
+		Help:      "Number of items re-added to a rate limited work queue.",
+	}, []string{"queue"})
+)
+
+func init() {
+	//The provider is only used by the queues created after it is set, so it needs to be set before any SetHandler is created
+	workqueue.SetProvider(workQueueMetricsProvider{})
+}
+
+//RegisterMetrics registers all the metrics of the CPUSetter controller into the provided registry
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{cpusetAdjustments, cpusetAdjustmentRetries, cpusetAdjustmentTimeouts, reconciliationDuration, driftRepairs,
+		workQueueDepth, workQueueAdds, workQueueLatency, workQueueWorkDuration, workQueueUnfinishedWork, workQueueLongestRunningProcessor, workQueueRetries} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//observeReconciliation records the duration of a reconciliation started at start, scope being either a single Pod or the whole Node
+func observeReconciliation(scope string, start time.Time) {
+	reconciliationDuration.WithLabelValues(scope).Observe(time.Since(start).Seconds())
+}
+
+//workQueueMetricsProvider exposes the built-in metrics of the client-go work queues through Prometheus, labelled with the name of the queue
+type workQueueMetricsProvider struct{}
+
+func (workQueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workQueueDepth.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workQueueAdds.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workQueueLatency.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workQueueWorkDuration.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workQueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workQueueLongestRunningProcessor.WithLabelValues(name)
+}
+
+func (workQueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workQueueRetries.WithLabelValues(name)
+}
@@ -0,0 +1,235 @@
+package sethandler
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	//MaxCgroupEventRetryCount controls how many times we re-try reconciling a Pod after one of its cgroups changed, while its status is not yet up-to-date
+	MaxCgroupEventRetryCount = 20
+	podUIDIndex              = "podUID"
+	podCgroupPrefix          = "pod"
+	systemdSliceSuffix       = ".slice"
+)
+
+var (
+	errUnknownPod         = errors.New("Pod is not yet known by the Pod informer")
+	errUnresolvedCgroups  = errors.New("Pod has container cgroups not yet listed in its status")
+	cgroupEventRetryDelay = time.Duration(RetryInterval) * time.Millisecond
+	maxCgroupEventDelay   = 2 * time.Second
+)
+
+func indexPodByUID(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return []string{}, nil
+	}
+	return []string{string(pod.ObjectMeta.UID)}, nil
+}
+
+//startCgroupWatcher registers an inotify watch on every directory of the cgroupfs hierarchy under cpusetRoot
+//Creation of new container cgroups, and modification of cpuset.cpus files are both turned into targeted Pod reconciliations
+func (setHandler *SetHandler) startCgroupWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = addWatchesRecursively(watcher, setHandler.cpusetRoot)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	setHandler.cgroupWatcher = watcher
+	setHandler.cgroupEvents = workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(cgroupEventRetryDelay, maxCgroupEventDelay), cgroupEventQueueName)
+	go setHandler.watchCgroupEvents()
+	return nil
+}
+
+func (setHandler *SetHandler) stopCgroupWatcher() {
+	if setHandler.cgroupWatcher != nil {
+		setHandler.cgroupWatcher.Close()
+	}
+	if setHandler.cgroupEvents != nil {
+		setHandler.cgroupEvents.ShutDown()
+	}
+}
+
+func addWatchesRecursively(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			//The cgroup might have been removed since we listed its parent
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	})
+}
+
+func (setHandler *SetHandler) watchCgroupEvents() {
+	for {
+		select {
+		case event, ok := <-setHandler.cgroupWatcher.Events:
+			if !ok {
+				log.Println("INFO: Shutting down the cgroupfs watcher thread")
+				return
+			}
+			setHandler.handleCgroupEvent(event)
+		case err, ok := <-setHandler.cgroupWatcher.Errors:
+			if !ok {
+				return
+			}
+			//Overflowing the inotify queue means we lost events, the periodic resync will eventually take care of them
+			log.Println("WARNING: cgroupfs watcher reported error:" + err.Error())
+		}
+	}
+}
+
+func (setHandler *SetHandler) handleCgroupEvent(event fsnotify.Event) {
+	if event.Op&fsnotify.Create == fsnotify.Create {
+		fileInfo, err := os.Stat(event.Name)
+		if err != nil || !fileInfo.IsDir() {
+			return
+		}
+		err = addWatchesRecursively(setHandler.cgroupWatcher, event.Name)
+		if err != nil {
+			log.Println("WARNING: could not watch new cgroup:" + event.Name + " because:" + err.Error())
+		}
+		setHandler.enqueueCgroupEvent(event.Name)
+		return
+	}
+	if event.Op&fsnotify.Write == fsnotify.Write && filepath.Base(event.Name) == cpusFile {
+		setHandler.enqueueCgroupEvent(filepath.Dir(event.Name))
+	}
+}
+
+//enqueueCgroupEvent queues the Pod level cgroup the changed cgroup belongs to, so only the cgroups of that Pod are walked during its reconciliation
+func (setHandler *SetHandler) enqueueCgroupEvent(cgroupPath string) {
+	_, podCgroupPath := podFromCgroupPath(setHandler.cpusetRoot, cgroupPath)
+	if podCgroupPath == "" {
+		return
+	}
+	setHandler.cgroupEvents.Add(podCgroupPath)
+}
+
+//podFromCgroupPath returns the UID of the Pod a cgroup belongs to, and the path of the Pod level cgroup
+//Empty strings are returned for cgroups not belonging to any Pod (e.g. QoS class level cgroups)
+func podFromCgroupPath(cpusetRoot string, cgroupPath string) (string, string) {
+	relativePath, err := filepath.Rel(cpusetRoot, cgroupPath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return "", ""
+	}
+	podCgroupPath := cpusetRoot
+	for _, cgroupName := range strings.Split(relativePath, string(filepath.Separator)) {
+		podCgroupPath = filepath.Join(podCgroupPath, cgroupName)
+		if podUID := podUIDFromCgroupName(cgroupName); podUID != "" {
+			return podUID, podCgroupPath
+		}
+	}
+	return "", ""
+}
+
+//podUIDFromCgroupName returns the UID of the Pod if the cgroup is a Pod level cgroup, or an empty string otherwise
+//The cgroupfs driver names them pod<uid>, while the systemd driver creates a kubepods[-<qos>]-pod<uid>.slice with the dashes of the UID escaped to underscores
+func podUIDFromCgroupName(cgroupName string) string {
+	if strings.HasSuffix(cgroupName, systemdSliceSuffix) {
+		sliceName := strings.TrimSuffix(cgroupName, systemdSliceSuffix)
+		podIndex := strings.LastIndex(sliceName, "-"+podCgroupPrefix)
+		if podIndex < 0 {
+			return ""
+		}
+		return strings.Replace(sliceName[podIndex+len("-"+podCgroupPrefix):], "_", "-", -1)
+	}
+	if strings.HasPrefix(cgroupName, podCgroupPrefix) {
+		return strings.TrimPrefix(cgroupName, podCgroupPrefix)
+	}
+	return ""
+}
+
+func (setHandler *SetHandler) runCgroupEventWorker() {
+	for setHandler.processNextCgroupEvent() {
+	}
+}
+
+func (setHandler *SetHandler) processNextCgroupEvent() bool {
+	obj, areWeShuttingDown := setHandler.cgroupEvents.Get()
+	if areWeShuttingDown {
+		return false
+	}
+	defer setHandler.cgroupEvents.Done(obj)
+	podCgroupPath, ok := obj.(string)
+	if !ok {
+		setHandler.cgroupEvents.Forget(obj)
+		return true
+	}
+	podUID, _ := podFromCgroupPath(setHandler.cpusetRoot, podCgroupPath)
+	err := setHandler.reconcilePodByUID(podUID, podCgroupPath)
+	if err == nil {
+		setHandler.cgroupEvents.Forget(obj)
+		return true
+	}
+	if setHandler.cgroupEvents.NumRequeues(obj) < MaxCgroupEventRetryCount {
+		setHandler.cgroupEvents.AddRateLimited(obj)
+		return true
+	}
+	log.Println("WARNING: Event driven reconciliation of Pod ID:" + podUID + " gave up after " + strconv.Itoa(MaxCgroupEventRetryCount) + " attempts because:" + err.Error())
+	setHandler.cgroupEvents.Forget(obj)
+	return true
+}
+
+//reconcilePodByUID reconciles the leaf cgroups found under the Pod level cgroup of the Pod with the given UID
+func (setHandler *SetHandler) reconcilePodByUID(podUID string, podCgroupPath string) error {
+	defer observeReconciliation("pod", time.Now())
+	if setHandler.podIndexer == nil {
+		return errUnknownPod
+	}
+	objs, err := setHandler.podIndexer.ByIndex(podUIDIndex, podUID)
+	if err != nil {
+		return err
+	}
+	if len(objs) == 0 {
+		return errUnknownPod
+	}
+	pod, ok := objs[0].(*v1.Pod)
+	if !ok {
+		return errUnknownPod
+	}
+	podLeaves, err := getLeafCgroups(podCgroupPath)
+	//The Pod might have been removed since its cgroup changed
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(podLeaves) == 0 {
+		return nil
+	}
+	setHandler.reconcilePod(podLeaves, *pod)
+	//Every cgroup except the infra container's should belong to a container listed in the status
+	unresolvedCgroups := 0
+	for _, leaf := range podLeaves {
+		if !containerIDInPodStatus(pod.Status, filepath.Base(leaf)) {
+			unresolvedCgroups++
+		}
+	}
+	if unresolvedCgroups > 1 {
+		return errUnresolvedCgroups
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package sethandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nokia/CPU-Pooler/test/utils"
+)
+
+func TestPodFromCgroupPath(t *testing.T) {
+	root := "/sys/fs/cgroup/cpuset/kubepods"
+	var tcs = []struct {
+		path        string
+		expectedUID string
+		expectedPod string
+	}{
+		{path: root + "/besteffort/pod0001/cont01", expectedUID: "0001", expectedPod: root + "/besteffort/pod0001"},
+		{path: root + "/pod0023/cont23/child", expectedUID: "0023", expectedPod: root + "/pod0023"},
+		{path: root + "/besteffort", expectedUID: "", expectedPod: ""},
+		{path: "/sys/fs/cgroup/cpuset/pod0001/cont01", expectedUID: "", expectedPod: ""},
+	}
+	systemdRoot := "/sys/fs/cgroup/cpuset/kubepods.slice"
+	var systemdTcs = []struct {
+		path        string
+		expectedUID string
+		expectedPod string
+	}{
+		{path: systemdRoot + "/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-cont03a.scope", expectedUID: "0003", expectedPod: systemdRoot + "/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice"},
+		{path: systemdRoot + "/kubepods-pod0023_aa.slice/cri-containerd-cont23.scope", expectedUID: "0023-aa", expectedPod: systemdRoot + "/kubepods-pod0023_aa.slice"},
+		{path: systemdRoot + "/kubepods-burstable.slice", expectedUID: "", expectedPod: ""},
+	}
+	for _, tc := range systemdTcs {
+		podUID, podPath := podFromCgroupPath(systemdRoot, tc.path)
+		if podUID != tc.expectedUID || podPath != tc.expectedPod {
+			t.Errorf("Cgroup: %s resolved to Pod: %s (%s), expected: %s (%s)", tc.path, podUID, podPath, tc.expectedUID, tc.expectedPod)
+		}
+	}
+	for _, tc := range tcs {
+		podUID, podPath := podFromCgroupPath(root, tc.path)
+		if podUID != tc.expectedUID || podPath != tc.expectedPod {
+			t.Errorf("Cgroup: %s resolved to Pod: %s (%s), expected: %s (%s)", tc.path, podUID, podPath, tc.expectedUID, tc.expectedPod)
+		}
+	}
+}
+
+func TestCgroupEventsEnqueuePod(t *testing.T) {
+	setHandler := setupCgroupTest(t, utils.CreateTempSysFs)
+	stopChan := make(chan struct{})
+	setHandler.stopChan = &stopChan
+	if err := setHandler.startCgroupWatcher(); err != nil {
+		t.Fatalf("cgroupfs watcher could not be started: %s", err.Error())
+	}
+	defer close(stopChan)
+	defer setHandler.stopCgroupWatcher()
+	newContainer := filepath.Join(setHandler.cpusetRoot, "besteffort/pod0002/cont02new")
+	if err := os.Mkdir(newContainer, 0755); err != nil {
+		t.Fatalf("New container cgroup could not be created: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(newContainer, cpusFile), []byte("0-79"), 0644); err != nil {
+		t.Fatalf("New container cpuset could not be written: %s", err.Error())
+	}
+	podCgroupPath, areWeShuttingDown := waitForCgroupEvent(setHandler)
+	if areWeShuttingDown || podCgroupPath != filepath.Join(setHandler.cpusetRoot, "besteffort/pod0002") {
+		t.Errorf("Creation of container cgroup did not trigger the reconciliation of its Pod, got: %v", podCgroupPath)
+	}
+}
+
+func waitForCgroupEvent(setHandler *SetHandler) (interface{}, bool) {
+	go func() {
+		time.Sleep(5 * time.Second)
+		setHandler.cgroupEvents.ShutDown()
+	}()
+	return setHandler.cgroupEvents.Get()
+}
@@ -1,36 +1,239 @@
 package topology
 
 import (
-	"bytes"
+	"fmt"
+	"io/ioutil"
 	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 	"log"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-//GetNodeTopology inspects the node's CPU architecture with lscpu, and returns a map of coreID-NUMA node ID associations
-func GetNodeTopology() map[int]int {
-	return listAndParseCores("node")
+const (
+	cpuSysfsDir  = "devices/system/cpu"
+	nodeSysfsDir = "devices/system/node"
+)
+
+var (
+	//SysfsRoot is the mount point of the sysfs filesystem the CPU topology is read from. Tests can point it to fixture trees
+	SysfsRoot = "/sys"
+)
+
+//CPU describes the location of one logical CPU in the topology of the node
+//Attributes which cannot be determined (e.g. topology of offline CPUs) are set to -1
+type CPU struct {
+	ID       int
+	Socket   int
+	Die      int
+	Core     int
+	NUMANode int
+	CacheID  int
+	Siblings cpuset.CPUSet
+	Online   bool
 }
 
-//GetHTTopology inspects the node's CPU architecture with lscpu, and returns a map of physical coreID-list of logical coreIDs associations
-func GetHTTopology() map[int]string {
-	coreMap := listAndParseCores("core")
-	htMap := make(map[int]string)
-	for logicalCoreID, physicalCoreID := range coreMap {
-		//We don't want to duplicate the physical core itself into the logical core ID list
-		if physicalCoreID != logicalCoreID {
-			logicalCoreIDStr := strconv.Itoa(logicalCoreID)
-			if htMap[physicalCoreID] != "" {
-				htMap[physicalCoreID] += ","
+//Topology is the model of all the logical CPUs of the node, keyed by their ID
+type Topology struct {
+	CPUs map[int]CPU
+}
+
+//GetTopology builds the CPU topology model of the node from the sysfs mounted under SysfsRoot
+func GetTopology() (Topology, error) {
+	return Discover(SysfsRoot)
+}
+
+//Discover builds the CPU topology model of the node from the sysfs tree mounted under the provided root
+//Sockets, dies, cores and thread siblings are read from the per CPU topology directories, last level caches from the per CPU cache directories, and NUMA nodes from the node directories
+func Discover(sysfsRoot string) (Topology, error) {
+	cpuDirs, err := filepath.Glob(filepath.Join(sysfsRoot, cpuSysfsDir, "cpu[0-9]*"))
+	if err != nil {
+		return Topology{}, err
+	}
+	if len(cpuDirs) == 0 {
+		return Topology{}, fmt.Errorf("no CPUs found under sysfs root: %s", sysfsRoot)
+	}
+	numaNodes, err := readNUMANodes(sysfsRoot)
+	if err != nil {
+		return Topology{}, err
+	}
+	onlineCPUs, err := readCPUListFile(filepath.Join(sysfsRoot, cpuSysfsDir, "online"))
+	if err != nil {
+		return Topology{}, err
+	}
+	topology := Topology{CPUs: make(map[int]CPU, len(cpuDirs))}
+	for _, cpuDir := range cpuDirs {
+		cpuID, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(cpuDir), "cpu"))
+		if err != nil {
+			continue
+		}
+		cpu := CPU{ID: cpuID, Socket: -1, Die: -1, Core: -1, NUMANode: -1, CacheID: -1, Siblings: cpuset.NewCPUSet(), Online: onlineCPUs.Contains(cpuID)}
+		if numaNode, exists := numaNodes[cpuID]; exists {
+			cpu.NUMANode = numaNode
+		}
+		if cpu.Online {
+			if err = readCPUTopology(cpuDir, &cpu); err != nil {
+				return Topology{}, fmt.Errorf("topology of CPU: %d could not be read because: %s", cpuID, err)
 			}
-			htMap[physicalCoreID] += logicalCoreIDStr
+			cpu.CacheID = readLastLevelCacheID(cpuDir)
 		}
+		topology.CPUs[cpuID] = cpu
+	}
+	return topology, nil
+}
+
+func readCPUTopology(cpuDir string, cpu *CPU) error {
+	var err error
+	topologyDir := filepath.Join(cpuDir, "topology")
+	if cpu.Socket, err = readIntFile(filepath.Join(topologyDir, "physical_package_id")); err != nil {
+		return err
+	}
+	if cpu.Core, err = readIntFile(filepath.Join(topologyDir, "core_id")); err != nil {
+		return err
+	}
+	if cpu.Siblings, err = readCPUListFile(filepath.Join(topologyDir, "thread_siblings_list")); err != nil {
+		return err
+	}
+	//Dies are only exposed by kernels 5.2 and newer, older kernels treat every package as one die
+	cpu.Die, err = readIntFile(filepath.Join(topologyDir, "die_id"))
+	if os.IsNotExist(err) {
+		cpu.Die, err = 0, nil
+	}
+	return err
+}
+
+//readLastLevelCacheID returns the ID of the highest level cache of a CPU, or -1 if the kernel does not expose cache information
+//Kernels not exposing the ID of the caches are handled by using the lowest CPU ID sharing the cache as its ID
+func readLastLevelCacheID(cpuDir string) int {
+	cacheDirs, _ := filepath.Glob(filepath.Join(cpuDir, "cache", "index[0-9]*"))
+	lastLevel, cacheID := -1, -1
+	for _, cacheDir := range cacheDirs {
+		level, err := readIntFile(filepath.Join(cacheDir, "level"))
+		if err != nil || level <= lastLevel {
+			continue
+		}
+		id, err := readIntFile(filepath.Join(cacheDir, "id"))
+		if err != nil {
+			sharedCPUs, listErr := readCPUListFile(filepath.Join(cacheDir, "shared_cpu_list"))
+			if listErr != nil || sharedCPUs.IsEmpty() {
+				continue
+			}
+			id = sharedCPUs.ToSlice()[0]
+		}
+		lastLevel, cacheID = level, id
+	}
+	return cacheID
+}
+
+//Kernels built without NUMA support do not have node directories, in which case every CPU belongs to node 0
+func readNUMANodes(sysfsRoot string) (map[int]int, error) {
+	numaNodes := make(map[int]int)
+	nodeDirs, err := filepath.Glob(filepath.Join(sysfsRoot, nodeSysfsDir, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeDirs) == 0 {
+		cpuDirs, _ := filepath.Glob(filepath.Join(sysfsRoot, cpuSysfsDir, "cpu[0-9]*"))
+		for _, cpuDir := range cpuDirs {
+			if cpuID, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(cpuDir), "cpu")); err == nil {
+				numaNodes[cpuID] = 0
+			}
+		}
+		return numaNodes, nil
+	}
+	for _, nodeDir := range nodeDirs {
+		nodeID, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(nodeDir), "node"))
+		if err != nil {
+			continue
+		}
+		nodeCPUs, err := readCPUListFile(filepath.Join(nodeDir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		for _, cpuID := range nodeCPUs.ToSlice() {
+			numaNodes[cpuID] = nodeID
+		}
+	}
+	return numaNodes, nil
+}
+
+//NUMANodes returns a map of coreID-NUMA node ID associations
+func (topology Topology) NUMANodes() map[int]int {
+	nodeMap := make(map[int]int)
+	for cpuID, cpu := range topology.CPUs {
+		if cpu.NUMANode >= 0 {
+			nodeMap[cpuID] = cpu.NUMANode
+		}
+	}
+	return nodeMap
+}
+
+//CacheDomains returns a map of coreID-last level cache ID associations
+func (topology Topology) CacheDomains() map[int]int {
+	cacheMap := make(map[int]int)
+	for cpuID, cpu := range topology.CPUs {
+		if cpu.CacheID >= 0 {
+			cacheMap[cpuID] = cpu.CacheID
+		}
+	}
+	return cacheMap
+}
+
+//HTSiblings returns a map of physical coreID-list of logical coreIDs associations
+//The lowest ID among the thread siblings of a core is considered to be the physical core
+func (topology Topology) HTSiblings() map[int]string {
+	htMap := make(map[int]string)
+	for cpuID, cpu := range topology.CPUs {
+		if cpu.Siblings.Size() < 2 || cpu.Siblings.ToSlice()[0] != cpuID {
+			continue
+		}
+		logicalCoreIDs := []string{}
+		for _, siblingID := range cpu.Siblings.ToSlice()[1:] {
+			logicalCoreIDs = append(logicalCoreIDs, strconv.Itoa(siblingID))
+		}
+		htMap[cpuID] = strings.Join(logicalCoreIDs, ",")
 	}
 	return htMap
 }
 
+//OnlineCPUs returns the set of CPUs which were online when the topology was discovered
+func (topology Topology) OnlineCPUs() cpuset.CPUSet {
+	onlineCPUs := []int{}
+	for cpuID, cpu := range topology.CPUs {
+		if cpu.Online {
+			onlineCPUs = append(onlineCPUs, cpuID)
+		}
+	}
+	sort.Ints(onlineCPUs)
+	return cpuset.NewCPUSet(onlineCPUs...)
+}
+
+//GetNodeTopology inspects the node's CPU architecture in sysfs, and returns a map of coreID-NUMA node ID associations
+func GetNodeTopology() map[int]int {
+	return getTopologyOrEmpty().NUMANodes()
+}
+
+//GetHTTopology inspects the node's CPU architecture in sysfs, and returns a map of physical coreID-list of logical coreIDs associations
+func GetHTTopology() map[int]string {
+	return getTopologyOrEmpty().HTSiblings()
+}
+
+//GetCacheTopology inspects the node's CPU architecture in sysfs, and returns a map of coreID-last level cache ID associations
+//Cores sharing the same last level cache ID belong to the same L3 cache domain
+func GetCacheTopology() map[int]int {
+	return getTopologyOrEmpty().CacheDomains()
+}
+
+func getTopologyOrEmpty() Topology {
+	topology, err := GetTopology()
+	if err != nil {
+		log.Println("ERROR: could not interrogate the CPU topology of the node from sysfs, because:" + err.Error())
+	}
+	return topology
+}
+
 //AddHTSiblingsToCPUSet takes an allocated exclusive CPU set and expands it with all the sibling threads belonging to the allocated physical cores
 func AddHTSiblingsToCPUSet(exclusiveCPUSet cpuset.CPUSet, coreMap map[int]string) cpuset.CPUSet {
 	tempSet := exclusiveCPUSet
@@ -47,38 +250,55 @@ func AddHTSiblingsToCPUSet(exclusiveCPUSet cpuset.CPUSet, coreMap map[int]string
 	return tempSet
 }
 
-//ExecCommand is generic wrapper around cmd.Run. It executes the exec.Cmd arriving as an input parameters, and either returns an error, or the stdout of the command to the caller
-//Used to interrogate CPU topology and cpusets directly from the host OS
-func ExecCommand(cmd *exec.Cmd) (string, error) {
-	var stdout bytes.Buffer
-	cmd.Stdout = &stdout
-	err := cmd.Run()
+//GetNUMANodesOfCPUSet returns the set of NUMA nodes hosting the CPUs of the provided set
+//CPUs missing from the provided coreID-NUMA node ID map are ignored
+func GetNUMANodesOfCPUSet(cpus cpuset.CPUSet, nodeMap map[int]int) cpuset.CPUSet {
+	nodeBuilder := cpuset.NewBuilder()
+	for _, cpuID := range cpus.ToSlice() {
+		if nodeID, exists := nodeMap[cpuID]; exists {
+			nodeBuilder.Add(nodeID)
+		}
+	}
+	return nodeBuilder.Result()
+}
+
+//GetOnlineCPUs returns the set of CPUs currently online on the node
+func GetOnlineCPUs() (cpuset.CPUSet, error) {
+	return readCPUListFile(filepath.Join(SysfsRoot, cpuSysfsDir, "online"))
+}
+
+//GetIsolatedCPUs returns the set of CPUs isolated from the general scheduler via the isolcpus kernel parameter
+func GetIsolatedCPUs() (cpuset.CPUSet, error) {
+	return readCPUListFile(filepath.Join(SysfsRoot, cpuSysfsDir, "isolated"))
+}
+
+//GetNohzFullCPUs returns the set of CPUs running in adaptive-tick mode via the nohz_full kernel parameter
+//An empty set is returned if the kernel was not compiled with adaptive-tick support
+func GetNohzFullCPUs() (cpuset.CPUSet, error) {
+	cpus, err := readCPUListFile(filepath.Join(SysfsRoot, cpuSysfsDir, "nohz_full"))
+	if os.IsNotExist(err) {
+		return cpuset.NewCPUSet(), nil
+	}
+	return cpus, err
+}
+
+func readCPUListFile(path string) (cpuset.CPUSet, error) {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
-		return "", err
+		return cpuset.NewCPUSet(), err
 	}
-	return string(stdout.Bytes()), nil
+	cpuList := strings.TrimSpace(string(content))
+	//The kernel prints (null) instead of an empty list into some of these files
+	if cpuList == "(null)" {
+		return cpuset.NewCPUSet(), nil
+	}
+	return cpuset.Parse(cpuList)
 }
 
-func listAndParseCores(attribute string) map[int]int {
-	coreMap := make(map[int]int)
-	outStr, err := ExecCommand(exec.Command("lscpu", "-p=cpu,"+attribute))
+func readIntFile(path string) (int, error) {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Println("ERROR: could not interrogate the CPU topology of the node with lscpu, because:" + err.Error())
-		return coreMap
-	}
-	//Here be dragons: we need to manually parse the stdout into a CPU core map line-by-line
-	//lscpu -p and -J options are mutually exclusive :(
-	for _, lsLine := range strings.Split(strings.TrimSuffix(outStr, "\n"), "\n") {
-		cpuInfoStr := strings.Split(lsLine, ",")
-		if len(cpuInfoStr) != 2 {
-			continue
-		}
-		cpuInt, cpuErr := strconv.Atoi(cpuInfoStr[0])
-		attributeInt, numaErr := strconv.Atoi(cpuInfoStr[1])
-		if cpuErr != nil || numaErr != nil {
-			continue
-		}
-		coreMap[cpuInt] = attributeInt
+		return -1, err
 	}
-	return coreMap
+	return strconv.Atoi(strings.TrimSpace(string(content)))
 }
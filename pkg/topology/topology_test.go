@@ -0,0 +1,96 @@
+package topology
+
+import (
+	"reflect"
+	"testing"
+)
+
+const (
+	htNUMASysfs = "../../test/testdata/sysfs/ht-numa"
+	flatSysfs   = "../../test/testdata/sysfs/flat"
+)
+
+func TestDiscover(t *testing.T) {
+	topology, err := Discover(htNUMASysfs)
+	if err != nil {
+		t.Fatalf("Topology could not be discovered: %s", err.Error())
+	}
+	if len(topology.CPUs) != 8 {
+		t.Fatalf("Expected 8 CPUs, got: %v", topology.CPUs)
+	}
+	cpu := topology.CPUs[6]
+	if cpu.Socket != 1 || cpu.Die != 0 || cpu.Core != 0 || cpu.NUMANode != 1 || cpu.CacheID != 1 || cpu.Siblings.String() != "2,6" || !cpu.Online {
+		t.Errorf("Unexpected topology of CPU 6: %+v", cpu)
+	}
+	offlineCPU := topology.CPUs[7]
+	if offlineCPU.Online || offlineCPU.Socket != -1 || offlineCPU.CacheID != -1 || offlineCPU.NUMANode != 1 {
+		t.Errorf("Unexpected topology of offline CPU 7: %+v", offlineCPU)
+	}
+	if onlineCPUs := topology.OnlineCPUs(); onlineCPUs.String() != "0-6" {
+		t.Errorf("Expected CPUs 0-6 to be online, got: %s", onlineCPUs)
+	}
+}
+
+func TestDiscoverMissingSysfs(t *testing.T) {
+	if _, err := Discover("../../test/testdata/sysfs/non-existing"); err == nil {
+		t.Errorf("Topology discovered from non-existing sysfs")
+	}
+}
+
+func TestTopologyMaps(t *testing.T) {
+	var tcs = []struct {
+		name          string
+		sysfsRoot     string
+		expectedNodes map[int]int
+		expectedCache map[int]int
+		expectedHT    map[int]string
+	}{
+		{"ht_numa", htNUMASysfs,
+			map[int]int{0: 0, 1: 0, 2: 1, 3: 1, 4: 0, 5: 0, 6: 1, 7: 1},
+			map[int]int{0: 0, 1: 0, 2: 1, 3: 1, 4: 0, 5: 0, 6: 1},
+			map[int]string{0: "4", 1: "5", 2: "6", 3: "7"}},
+		{"flat", flatSysfs,
+			map[int]int{0: 0, 1: 0},
+			map[int]int{0: 0, 1: 0},
+			map[int]string{}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			topology, err := Discover(tc.sysfsRoot)
+			if err != nil {
+				t.Fatalf("Topology could not be discovered: %s", err.Error())
+			}
+			if nodes := topology.NUMANodes(); !reflect.DeepEqual(nodes, tc.expectedNodes) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) NUMA nodes", tc.expectedNodes, nodes)
+			}
+			if caches := topology.CacheDomains(); !reflect.DeepEqual(caches, tc.expectedCache) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) cache domains", tc.expectedCache, caches)
+			}
+			if siblings := topology.HTSiblings(); !reflect.DeepEqual(siblings, tc.expectedHT) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) HT siblings", tc.expectedHT, siblings)
+			}
+		})
+	}
+}
+
+func TestGetCPUStates(t *testing.T) {
+	originalRoot := SysfsRoot
+	SysfsRoot = htNUMASysfs
+	defer func() { SysfsRoot = originalRoot }()
+	onlineCPUs, err := GetOnlineCPUs()
+	if err != nil || onlineCPUs.String() != "0-6" {
+		t.Errorf("Unexpected online CPUs: %s, error: %v", onlineCPUs, err)
+	}
+	isolatedCPUs, err := GetIsolatedCPUs()
+	if err != nil || isolatedCPUs.String() != "1-3,5-6" {
+		t.Errorf("Unexpected isolated CPUs: %s, error: %v", isolatedCPUs, err)
+	}
+	nohzFullCPUs, err := GetNohzFullCPUs()
+	if err != nil || !nohzFullCPUs.IsEmpty() {
+		t.Errorf("Unexpected nohz_full CPUs: %s, error: %v", nohzFullCPUs, err)
+	}
+	SysfsRoot = flatSysfs
+	if nohzFullCPUs, err = GetNohzFullCPUs(); err != nil || !nohzFullCPUs.IsEmpty() {
+		t.Errorf("Missing nohz_full support is not handled, CPUs: %s, error: %v", nohzFullCPUs, err)
+	}
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"encoding/json"
 	"errors"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/golang/glog"
@@ -11,33 +13,89 @@ import (
 // Process defines process information in pod annotation
 // The information is used for setting CPU affinity
 type Process struct {
-	ProcName string   `json:"process"`
-	Args     []string `json:"args"`
-	CPUs     int      `json:"cpus"`
-	PoolName string   `json:"pool"`
+	ProcName      string   `json:"process"`
+	Args          []string `json:"args"`
+	CPUs          int      `json:"cpus"`
+	PoolName      string   `json:"pool"`
+	RestartPolicy string   `json:"restartPolicy,omitempty"`
+	Critical      bool     `json:"critical,omitempty"`
+	SchedPolicy   string   `json:"schedPolicy,omitempty"`
+	Priority      int      `json:"priority,omitempty"`
+	Nice          int      `json:"nice,omitempty"`
+	Threads       []Thread `json:"threads,omitempty"`
+}
+
+// Thread defines the CPUs of the threads of a process whose name matches a pattern
+// The threads are pinned by process-starter as they appear, while the rest of the threads keep the CPUs of the process
+type Thread struct {
+	Name     string `json:"name"`
+	CPUs     int    `json:"cpus"`
+	PoolName string `json:"pool"`
 }
 
 // Container idenfifies container and defines the processes to be started
+// When Supervise is set process-starter stays as the init process of the container, and supervises the processes
 type Container struct {
 	Name      string    `json:"container"`
 	Processes []Process `json:"processes"`
+	Supervise bool      `json:"supervise,omitempty"`
 }
 
 // CPUAnnotation defines the pod cpu annotation structure
 type CPUAnnotation map[string]Container
 
+// Restart policies of the processes supervised by process-starter
+const (
+	RestartPolicyNever     = "never"
+	RestartPolicyOnFailure = "on-failure"
+	RestartPolicyAlways    = "always"
+)
+
+// Scheduling policies of the processes started by process-starter
+const (
+	SchedPolicyOther = "SCHED_OTHER"
+	SchedPolicyFIFO  = "SCHED_FIFO"
+	SchedPolicyRR    = "SCHED_RR"
+	SchedPolicyBatch = "SCHED_BATCH"
+	SchedPolicyIdle  = "SCHED_IDLE"
+)
+
+// Valid ranges of the real-time priority and the nice value of a process
+const (
+	MinRealTimePriority = 1
+	MaxRealTimePriority = 99
+	MinNice             = -20
+	MaxNice             = 19
+)
+
 const (
 	validationErrNoContainerName int = iota
 	validationErrNoProcesses
 	validationErrNoProcessName
 	validationErrNoCpus
+	validationErrInvalidRestartPolicy
+	validationErrSupervisionRequired
+	validationErrInvalidSchedPolicy
+	validationErrInvalidPriority
+	validationErrInvalidNice
+	validationErrNoThreadName
+	validationErrInvalidThreadName
+	validationErrNoThreadCpus
 )
 
 var validationErrStr = map[int]string{
-	validationErrNoContainerName: "'container' is mandatory in annotation",
-	validationErrNoProcesses:     "'processes' is mandatory in annotation",
-	validationErrNoProcessName:   "'process' (name) is mandatory in annotation",
-	validationErrNoCpus:          "'cpus' field is mandatory in annotation",
+	validationErrNoContainerName:      "'container' is mandatory in annotation",
+	validationErrNoProcesses:          "'processes' is mandatory in annotation",
+	validationErrNoProcessName:        "'process' (name) is mandatory in annotation",
+	validationErrNoCpus:               "'cpus' field is mandatory in annotation",
+	validationErrInvalidRestartPolicy: "'restartPolicy' must be one of '" + RestartPolicyNever + "', '" + RestartPolicyOnFailure + "' or '" + RestartPolicyAlways + "'",
+	validationErrSupervisionRequired:  "'restartPolicy', 'critical' and 'threads' are only allowed in containers with 'supervise' set",
+	validationErrInvalidSchedPolicy:   "'schedPolicy' must be one of '" + SchedPolicyOther + "', '" + SchedPolicyFIFO + "', '" + SchedPolicyRR + "', '" + SchedPolicyBatch + "' or '" + SchedPolicyIdle + "'",
+	validationErrInvalidPriority:      "'priority' between " + strconv.Itoa(MinRealTimePriority) + " and " + strconv.Itoa(MaxRealTimePriority) + " is mandatory for real-time 'schedPolicy', and not allowed otherwise",
+	validationErrInvalidNice:          "'nice' must be between " + strconv.Itoa(MinNice) + " and " + strconv.Itoa(MaxNice) + ", and is not allowed for real-time 'schedPolicy'",
+	validationErrNoThreadName:         "'name' is mandatory in threads of annotation",
+	validationErrInvalidThreadName:    "'name' of threads must be a valid shell pattern",
+	validationErrNoThreadCpus:         "'cpus' field is mandatory in threads of annotation, and must be positive",
 }
 
 // NewCPUAnnotation returns a new CPUAnnotation
@@ -69,8 +127,10 @@ func (cpuAnnotation CPUAnnotation) ContainerSharedCPUTime(container string) int
 	for _, cont := range cpuAnnotation {
 		if cont.Name == container {
 			for _, process := range cont.Processes {
-				if strings.HasPrefix(process.PoolName, "shared") {
-					cpuTime += process.CPUs
+				for _, request := range process.cpuRequests() {
+					if strings.HasPrefix(request.PoolName, "shared") {
+						cpuTime += request.CPUs
+					}
 				}
 			}
 		}
@@ -86,8 +146,10 @@ func (cpuAnnotation CPUAnnotation) ContainerExclusiveCPU(container string) int {
 	for _, cont := range cpuAnnotation {
 		if cont.Name == container {
 			for _, process := range cont.Processes {
-				if strings.HasPrefix(process.PoolName, "exclusive") {
-					cpuTime += process.CPUs
+				for _, request := range process.cpuRequests() {
+					if strings.HasPrefix(request.PoolName, "exclusive") {
+						cpuTime += request.CPUs
+					}
 				}
 			}
 		}
@@ -102,9 +164,11 @@ func (cpuAnnotation CPUAnnotation) ContainerPools(cName string) (pools []string)
 	for _, container := range cpuAnnotation {
 		if container.Name == cName {
 			for _, process := range container.Processes {
-				if _, ok := poolMap[process.PoolName]; !ok {
-					pools = append(pools, process.PoolName)
-					poolMap[process.PoolName] = true
+				for _, request := range process.cpuRequests() {
+					if _, ok := poolMap[request.PoolName]; !ok {
+						pools = append(pools, request.PoolName)
+						poolMap[request.PoolName] = true
+					}
 				}
 			}
 		}
@@ -118,8 +182,10 @@ func (cpuAnnotation CPUAnnotation) ContainerTotalCPURequest(pool string, cName s
 	for _, container := range cpuAnnotation {
 		if container.Name == cName {
 			for _, process := range container.Processes {
-				if process.PoolName == pool {
-					cpuRequest += process.CPUs
+				for _, request := range process.cpuRequests() {
+					if request.PoolName == pool {
+						cpuRequest += request.CPUs
+					}
 				}
 			}
 		}
@@ -157,7 +223,78 @@ func (cpuAnnotation CPUAnnotation) Decode(annotation []byte) error {
 				return errors.New(validationErrStr[validationErrNoCpus])
 
 			}
+			if !IsValidRestartPolicy(p.RestartPolicy) {
+				return errors.New(validationErrStr[validationErrInvalidRestartPolicy])
+			}
+			if !c.Supervise && (p.RestartPolicy != "" || p.Critical || len(p.Threads) > 0) {
+				return errors.New(validationErrStr[validationErrSupervisionRequired])
+			}
+			if err := validateScheduling(p); err != nil {
+				return err
+			}
+			for _, thread := range p.Threads {
+				if err := validateThread(thread); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsValidRestartPolicy tells if restart policy is known. Empty policy is the same as never
+func IsValidRestartPolicy(policy string) bool {
+	switch policy {
+	case "", RestartPolicyNever, RestartPolicyOnFailure, RestartPolicyAlways:
+		return true
+	}
+	return false
+}
+
+// IsRealTimeSchedPolicy tells if scheduling policy is one of the real-time policies
+func IsRealTimeSchedPolicy(policy string) bool {
+	return policy == SchedPolicyFIFO || policy == SchedPolicyRR
+}
+
+func validateScheduling(p Process) error {
+	switch p.SchedPolicy {
+	case "", SchedPolicyOther, SchedPolicyBatch, SchedPolicyIdle, SchedPolicyFIFO, SchedPolicyRR:
+	default:
+		return errors.New(validationErrStr[validationErrInvalidSchedPolicy])
+	}
+	if IsRealTimeSchedPolicy(p.SchedPolicy) {
+		if p.Priority < MinRealTimePriority || p.Priority > MaxRealTimePriority {
+			return errors.New(validationErrStr[validationErrInvalidPriority])
 		}
+		if p.Nice != 0 {
+			return errors.New(validationErrStr[validationErrInvalidNice])
+		}
+		return nil
+	}
+	if p.Priority != 0 {
+		return errors.New(validationErrStr[validationErrInvalidPriority])
+	}
+	if p.Nice < MinNice || p.Nice > MaxNice {
+		return errors.New(validationErrStr[validationErrInvalidNice])
+	}
+	return nil
+}
+
+// cpuRequests returns the CPUs the process, and its pinned threads take from the pools of the container
+func (process Process) cpuRequests() []Thread {
+	requests := []Thread{{Name: process.ProcName, CPUs: process.CPUs, PoolName: process.PoolName}}
+	return append(requests, process.Threads...)
+}
+
+func validateThread(thread Thread) error {
+	if len(thread.Name) == 0 {
+		return errors.New(validationErrStr[validationErrNoThreadName])
+	}
+	if _, err := filepath.Match(thread.Name, ""); err != nil {
+		return errors.New(validationErrStr[validationErrInvalidThreadName])
+	}
+	if thread.CPUs <= 0 {
+		return errors.New(validationErrStr[validationErrNoThreadCpus])
 	}
 	return nil
 }
@@ -118,3 +118,106 @@ func TestContainerDecodeAnnotationNoCpus(t *testing.T) {
 
 	}
 }
+
+func TestContainerDecodeAnnotationRestartPolicy(t *testing.T) {
+	var tcs = []struct {
+		name        string
+		annotation  string
+		expectedErr string
+	}{
+		{name: "supervised", annotation: `[{"container": "cputestcontainer", "supervise": true, "processes": [{"process": "/bin/sh", "args": ["-c","/thread_busyloop"], "cpus": 1, "pool": "exclusive-pool1", "restartPolicy": "on-failure", "critical": true}]}]`},
+		{name: "invalid_policy", annotation: `[{"container": "cputestcontainer", "supervise": true, "processes": [{"process": "/bin/sh", "args": ["-c","/thread_busyloop"], "cpus": 1, "pool": "exclusive-pool1", "restartPolicy": "sometimes"}]}]`, expectedErr: validationErrStr[validationErrInvalidRestartPolicy]},
+		{name: "not_supervised", annotation: `[{"container": "cputestcontainer", "processes": [{"process": "/bin/sh", "args": ["-c","/thread_busyloop"], "cpus": 1, "pool": "exclusive-pool1", "restartPolicy": "always"}]}]`, expectedErr: validationErrStr[validationErrSupervisionRequired]},
+		{name: "critical_not_supervised", annotation: `[{"container": "cputestcontainer", "processes": [{"process": "/bin/sh", "args": ["-c","/thread_busyloop"], "cpus": 1, "pool": "exclusive-pool1", "critical": true}]}]`, expectedErr: validationErrStr[validationErrSupervisionRequired]},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ca := CPUAnnotation{}
+			err := ca.Decode([]byte(tc.annotation))
+			if tc.expectedErr == "" && err != nil {
+				t.Errorf("Decode unexpectedly failed: %s", err.Error())
+			}
+			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
+				t.Errorf("Unexpected error, expected: %s, actual: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestContainerDecodeAnnotationScheduling(t *testing.T) {
+	var tcs = []struct {
+		name        string
+		process     string
+		expectedErr string
+	}{
+		{name: "fifo", process: `"schedPolicy": "SCHED_FIFO", "priority": 50`},
+		{name: "rr", process: `"schedPolicy": "SCHED_RR", "priority": 99`},
+		{name: "nice", process: `"nice": 10`},
+		{name: "batch_nice", process: `"schedPolicy": "SCHED_BATCH", "nice": -5`},
+		{name: "unknown_policy", process: `"schedPolicy": "SCHED_DEADLINE"`, expectedErr: validationErrStr[validationErrInvalidSchedPolicy]},
+		{name: "fifo_without_priority", process: `"schedPolicy": "SCHED_FIFO"`, expectedErr: validationErrStr[validationErrInvalidPriority]},
+		{name: "priority_out_of_range", process: `"schedPolicy": "SCHED_RR", "priority": 100`, expectedErr: validationErrStr[validationErrInvalidPriority]},
+		{name: "priority_without_rt_policy", process: `"priority": 10`, expectedErr: validationErrStr[validationErrInvalidPriority]},
+		{name: "fifo_nice", process: `"schedPolicy": "SCHED_FIFO", "priority": 10, "nice": 5`, expectedErr: validationErrStr[validationErrInvalidNice]},
+		{name: "nice_out_of_range", process: `"nice": -21`, expectedErr: validationErrStr[validationErrInvalidNice]},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			annotation := `[{"container": "cputestcontainer", "processes": [{"process": "/bin/sh", "args": ["-c","/thread_busyloop"], "cpus": 1, "pool": "exclusive-pool1", ` + tc.process + `}]}]`
+			ca := CPUAnnotation{}
+			err := ca.Decode([]byte(annotation))
+			if tc.expectedErr == "" && err != nil {
+				t.Errorf("Decode unexpectedly failed: %s", err.Error())
+			}
+			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
+				t.Errorf("Unexpected error, expected: %s, actual: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestContainerDecodeAnnotationThreads(t *testing.T) {
+	var tcs = []struct {
+		name        string
+		supervise   bool
+		threads     string
+		expectedErr string
+	}{
+		{name: "threads", supervise: true, threads: `[{"name": "lcore-worker-*", "cpus": 2, "pool": "exclusive-pool2"}]`},
+		{name: "not_supervised", threads: `[{"name": "lcore-worker-*", "cpus": 2, "pool": "exclusive-pool2"}]`, expectedErr: validationErrStr[validationErrSupervisionRequired]},
+		{name: "no_name", supervise: true, threads: `[{"cpus": 2, "pool": "exclusive-pool2"}]`, expectedErr: validationErrStr[validationErrNoThreadName]},
+		{name: "invalid_pattern", supervise: true, threads: `[{"name": "lcore-worker-[", "cpus": 2, "pool": "exclusive-pool2"}]`, expectedErr: validationErrStr[validationErrInvalidThreadName]},
+		{name: "no_cpus", supervise: true, threads: `[{"name": "lcore-worker-*", "pool": "exclusive-pool2"}]`, expectedErr: validationErrStr[validationErrNoThreadCpus]},
+		{name: "negative_cpus", supervise: true, threads: `[{"name": "lcore-worker-*", "cpus": -1, "pool": "exclusive-pool2"}]`, expectedErr: validationErrStr[validationErrNoThreadCpus]},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			supervise := "false"
+			if tc.supervise {
+				supervise = "true"
+			}
+			annotation := `[{"container": "cputestcontainer", "supervise": ` + supervise + `, "processes": [{"process": "/bin/dpdk", "args": [], "cpus": 100, "pool": "shared-pool1", "threads": ` + tc.threads + `}]}]`
+			ca := CPUAnnotation{}
+			err := ca.Decode([]byte(annotation))
+			if tc.expectedErr == "" && err != nil {
+				t.Errorf("Decode unexpectedly failed: %s", err.Error())
+			}
+			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
+				t.Errorf("Unexpected error, expected: %s, actual: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestContainerThreadCPURequests(t *testing.T) {
+	ca := NewCPUAnnotation()
+	ca["Container1"] = Container{Name: "Container1", Supervise: true, Processes: []Process{
+		{ProcName: "dpdk", CPUs: 100, PoolName: "shared-pool1", Threads: []Thread{
+			{Name: "lcore-worker-*", CPUs: 2, PoolName: "exclusive-pool2"},
+			{Name: "eal-intr-thread", CPUs: 50, PoolName: "shared-pool1"}}},
+		{ProcName: "proc2", CPUs: 1, PoolName: "exclusive-pool2"}}}
+	assert.ElementsMatch(t, []string{"shared-pool1", "exclusive-pool2"}, ca.ContainerPools("Container1"))
+	assert.Equal(t, 3, ca.ContainerExclusiveCPU("Container1"))
+	assert.Equal(t, 3, ca.ContainerTotalCPURequest("exclusive-pool2", "Container1"))
+	assert.Equal(t, 150, ca.ContainerSharedCPUTime("Container1"))
+}
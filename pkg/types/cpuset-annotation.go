@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// CpusetAnnotationKey is the key of the Pod annotation CPUSetter publishes the applied cpusets of the containers in
+	CpusetAnnotationKey = "nokia.k8s.io/cpusets"
+	// CpusetsConfiguredAnnotationKey is the key of the Pod annotation CPUSetter marks the Pod with once all its containers are provisioned
+	CpusetsConfiguredAnnotationKey = "nokia.k8s.io/cpusets-configured"
+)
+
+// ContainerCpuset describes the cpuset CPUSetter provisioned to one container
+type ContainerCpuset struct {
+	Name      string    `json:"container"`
+	Cpuset    string    `json:"cpuset"`
+	Pools     []string  `json:"pools"`
+	HTPolicy  string    `json:"hyperThreadingPolicy,omitempty"`
+	NUMANodes string    `json:"numaNodes"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CpusetAnnotation defines the structure of the applied cpusets annotation
+// Same as the cpus annotation it is kept as an array of containers
+type CpusetAnnotation []ContainerCpuset
+
+// Container returns the applied cpuset of the named container, if the annotation lists it
+func (cpusetAnnotation CpusetAnnotation) Container(name string) (ContainerCpuset, bool) {
+	for _, container := range cpusetAnnotation {
+		if container.Name == name {
+			return container, true
+		}
+	}
+	return ContainerCpuset{}, false
+}
+
+// Update replaces the entries of the annotation belonging to the same containers as the provided ones, and appends the rest
+func (cpusetAnnotation CpusetAnnotation) Update(containers ...ContainerCpuset) CpusetAnnotation {
+	updated := append(CpusetAnnotation{}, cpusetAnnotation...)
+	for _, container := range containers {
+		replaced := false
+		for i := range updated {
+			if updated[i].Name == container.Name {
+				updated[i] = container
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			updated = append(updated, container)
+		}
+	}
+	return updated
+}
+
+// Encode marshals the annotation to its json form
+func (cpusetAnnotation CpusetAnnotation) Encode() (string, error) {
+	encoded, err := json.Marshal(cpusetAnnotation)
+	return string(encoded), err
+}
+
+// DecodeCpusetAnnotation unmarshals a json applied cpusets annotation
+func DecodeCpusetAnnotation(annotation []byte) (CpusetAnnotation, error) {
+	cpusetAnnotation := CpusetAnnotation{}
+	err := json.Unmarshal(annotation, &cpusetAnnotation)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range cpusetAnnotation {
+		if container.Name == "" {
+			return nil, errors.New("'container' is mandatory in applied cpusets annotation")
+		}
+	}
+	return cpusetAnnotation, nil
+}
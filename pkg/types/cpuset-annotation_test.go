@@ -0,0 +1,45 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCpusetAnnotationRoundTrip(t *testing.T) {
+	timestamp := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	original := CpusetAnnotation{
+		{Name: "dpdk", Cpuset: "2-3,10-11", Pools: []string{"exclusive_caas"}, HTPolicy: MultiThreadHTPolicy, NUMANodes: "0", Timestamp: timestamp},
+		{Name: "sidecar", Cpuset: "0-1", Pools: []string{DefaultPoolID}, NUMANodes: "0-1", Timestamp: timestamp},
+	}
+	encoded, err := original.Encode()
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	decoded, err := DecodeCpusetAnnotation([]byte(encoded))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	assert.Equal(t, original, decoded)
+	sidecar, found := decoded.Container("sidecar")
+	assert.True(t, found)
+	assert.Equal(t, "0-1", sidecar.Cpuset)
+	_, found = decoded.Container("missing")
+	assert.False(t, found)
+}
+
+func TestCpusetAnnotationUpdate(t *testing.T) {
+	original := CpusetAnnotation{{Name: "first", Cpuset: "1"}, {Name: "second", Cpuset: "2"}}
+	updated := original.Update(ContainerCpuset{Name: "second", Cpuset: "4-5"}, ContainerCpuset{Name: "third", Cpuset: "3"})
+	assert.Equal(t, CpusetAnnotation{{Name: "first", Cpuset: "1"}, {Name: "second", Cpuset: "4-5"}, {Name: "third", Cpuset: "3"}}, updated)
+	assert.Equal(t, "2", original[1].Cpuset, "Update modified the original annotation")
+}
+
+func TestDecodeCpusetAnnotationFail(t *testing.T) {
+	for _, annotation := range []string{`{"container": "notalist"}`, `[{"cpuset": "0-1"}]`} {
+		if _, err := DecodeCpusetAnnotation([]byte(annotation)); err == nil {
+			t.Errorf("Decode of invalid annotation: %s unexpectedly succeeded", annotation)
+		}
+	}
+}
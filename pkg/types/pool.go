@@ -22,6 +22,10 @@ const (
 	SingleThreadHTPolicy = "singleThreaded"
 	//MultiThreadHTPolicy is the constant for the multi threaded value of the HT policy pool attribute. All siblings are allocated together for exclusive requests when this value is set
 	MultiThreadHTPolicy = "multiThreaded"
+	//IsolcpusIsolation is one of the possible values of the required isolation pool attribute. Exclusive CPUs not isolated via the isolcpus kernel parameter are reported unhealthy when set
+	IsolcpusIsolation = "isolcpus"
+	//NohzFullIsolation is one of the possible values of the required isolation pool attribute. Exclusive CPUs not running in nohz_full mode are reported unhealthy when set
+	NohzFullIsolation = "nohz_full"
 )
 
 var (
@@ -31,9 +35,11 @@ var (
 
 // Pool defines cpupool
 type Pool struct {
-	CPUset   cpuset.CPUSet
-	CPUStr   string `yaml:"cpus"`
-	HTPolicy string `yaml:"hyperThreadingPolicy"`
+	CPUset            cpuset.CPUSet
+	CPUStr            string   `yaml:"cpus"`
+	HTPolicy          string   `yaml:"hyperThreadingPolicy"`
+	RequiredIsolation []string `yaml:"requiredIsolation"`
+	NUMALocalMemory   bool     `yaml:"numaLocalMemory"`
 }
 
 // PoolConfig defines pool configuration for a node
@@ -107,14 +113,23 @@ func ReadPoolConfigFile(name string) (PoolConfig, error) {
 		if poolBody.HTPolicy == "" {
 			tempPool.HTPolicy = SingleThreadHTPolicy
 		}
+		for _, isolation := range poolBody.RequiredIsolation {
+			if isolation != IsolcpusIsolation && isolation != NohzFullIsolation {
+				return PoolConfig{}, fmt.Errorf("required isolation: %s of pool: %s is not one of: %s, %s", isolation, poolName, IsolcpusIsolation, NohzFullIsolation)
+			}
+		}
 		poolConfig.Pools[poolName] = tempPool
 	}
 	return poolConfig, err
 }
 
 //SelectPool returns the exact CPUSet belonging to either the exclusive, shared, or default pool of one PoolConfig object
+//A pool exactly matching the provided name is preferred, otherwise the first pool whose name begins with the prefix is returned
 //An empty CPUSet is returned in case the configuration does not contain the requested type
 func (poolConf PoolConfig) SelectPool(prefix string) Pool {
+	if pool, exists := poolConf.Pools[prefix]; exists {
+		return pool
+	}
 	for poolName, pool := range poolConf.Pools {
 		if strings.HasPrefix(poolName, prefix) {
 			return pool
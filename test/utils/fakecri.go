@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// FakeCRIServer serves the cgroup paths of a static set of containers and Pod sandboxes on the CRI RuntimeService
+type FakeCRIServer struct {
+	criapi.UnimplementedRuntimeServiceServer
+	containerCgroups map[string]string
+	sandboxes        map[string]FakeSandbox
+	grpcServer       *grpc.Server
+	socket           string
+}
+
+// FakeSandbox describes a ready Pod sandbox known to the fake CRI server
+type FakeSandbox struct {
+	PodUID     string
+	CgroupPath string
+}
+
+// StartFakeCRIServer starts serving the provided container cgroups (keyed by container ID) and sandboxes (keyed by sandbox ID) on the provided unix socket
+func StartFakeCRIServer(socket string, containerCgroups map[string]string, sandboxes map[string]FakeSandbox) (*FakeCRIServer, error) {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	fakeServer := &FakeCRIServer{containerCgroups: containerCgroups, sandboxes: sandboxes, grpcServer: grpc.NewServer(), socket: socket}
+	criapi.RegisterRuntimeServiceServer(fakeServer.grpcServer, fakeServer)
+	go fakeServer.grpcServer.Serve(lis)
+	return fakeServer, nil
+}
+
+// ContainerStatus returns the cgroup path of a known container in its verbose info, same as containerd does
+func (fakeServer *FakeCRIServer) ContainerStatus(ctx context.Context, req *criapi.ContainerStatusRequest) (*criapi.ContainerStatusResponse, error) {
+	cgroupPath, exists := fakeServer.containerCgroups[req.GetContainerId()]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "container %s not found", req.GetContainerId())
+	}
+	return &criapi.ContainerStatusResponse{
+		Status: &criapi.ContainerStatus{Id: req.GetContainerId(), State: criapi.ContainerState_CONTAINER_RUNNING},
+		Info:   verboseCgroupInfo(cgroupPath),
+	}, nil
+}
+
+// ListPodSandbox returns the sandboxes matching the Pod UID label of the filter
+func (fakeServer *FakeCRIServer) ListPodSandbox(ctx context.Context, req *criapi.ListPodSandboxRequest) (*criapi.ListPodSandboxResponse, error) {
+	podUID := req.GetFilter().GetLabelSelector()["io.kubernetes.pod.uid"]
+	items := []*criapi.PodSandbox{}
+	for sandboxID, sandbox := range fakeServer.sandboxes {
+		if podUID == "" || sandbox.PodUID == podUID {
+			items = append(items, &criapi.PodSandbox{Id: sandboxID, State: criapi.PodSandboxState_SANDBOX_READY, Labels: map[string]string{"io.kubernetes.pod.uid": sandbox.PodUID}})
+		}
+	}
+	return &criapi.ListPodSandboxResponse{Items: items}, nil
+}
+
+// PodSandboxStatus returns the cgroup path of a known sandbox in its verbose info
+func (fakeServer *FakeCRIServer) PodSandboxStatus(ctx context.Context, req *criapi.PodSandboxStatusRequest) (*criapi.PodSandboxStatusResponse, error) {
+	sandbox, exists := fakeServer.sandboxes[req.GetPodSandboxId()]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "sandbox %s not found", req.GetPodSandboxId())
+	}
+	return &criapi.PodSandboxStatusResponse{
+		Status: &criapi.PodSandboxStatus{Id: req.GetPodSandboxId(), State: criapi.PodSandboxState_SANDBOX_READY},
+		Info:   verboseCgroupInfo(sandbox.CgroupPath),
+	}, nil
+}
+
+// Stop shuts down the fake server, and removes its socket
+func (fakeServer *FakeCRIServer) Stop() {
+	fakeServer.grpcServer.Stop()
+	os.Remove(fakeServer.socket)
+}
+
+func verboseCgroupInfo(cgroupPath string) map[string]string {
+	info := map[string]interface{}{"runtimeSpec": map[string]interface{}{"linux": map[string]interface{}{"cgroupsPath": cgroupPath}}}
+	rawInfo, _ := json.Marshal(info)
+	return map[string]string{"info": string(rawInfo)}
+}
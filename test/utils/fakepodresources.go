@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/nokia/CPU-Pooler/pkg/podresources"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+//FakePodResourcesServer serves a static list of Pod resource allocations on the kubelet PodResources API
+type FakePodResourcesServer struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+	podResources []*podresourcesapi.PodResources
+	grpcServer   *grpc.Server
+	socket       string
+	listCalls    int32
+	getCalls     int32
+}
+
+var fakePodResources = []*podresourcesapi.PodResources{
+	{Name: "pod_exc", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exc", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"3", "4"}}}}}},
+	{Name: "pod_excl_two_container", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_excl1", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"3", "4"}}}},
+		{Name: "cont_excl2", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"5", "6", "7"}}}}}},
+	{Name: "pod_two_container_sh_exc", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exclusive", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"8"}}}},
+		{Name: "cont_shared", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/shared_caas", DeviceIds: []string{"74", "97"}}}}}},
+	{Name: "pod_three_cont_sh_exc_def", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exclusive", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"3"}}}}}},
+	{Name: "pod_exc_pin_2_proc_2_cont", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exc_pin1", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"12", "13"}}}},
+		{Name: "cont_exc_pin2", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"14", "16"}}}}}},
+	{Name: "pod_exc_pin_2_proc_1_cont", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exc_pin", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"6"}}}}}},
+	{Name: "pod_pin_2_proc_exc_shared", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_pin_exc_shared", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"16"}}}}}},
+	{Name: "chckpnt_no_device", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "chckpnt_no_device", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas"}}}}},
+	{Name: "chckpnt_no_res", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "chckpnt_no_res", Devices: []*podresourcesapi.ContainerDevices{{DeviceIds: []string{"4"}}}}}},
+	{Name: "chckpnt_no_device_no_res", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "chckpnt_no_device_no_res"}}},
+	{Name: "bad_deviceID_format", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "bad_deviceID_format", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"a", "b", "c"}}}}}},
+	{Name: "no_cpuset_file", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "no_cpuset_file", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"3", "4", "7"}}}}}},
+	{Name: "naming_mismatch", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "naming_mismatch", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"3", "4", "7"}}}}}},
+	{Name: "pod_ht_test", Containers: []*podresourcesapi.ContainerResources{
+		{Name: "cont_exc_ht", Devices: []*podresourcesapi.ContainerDevices{{ResourceName: "nokia.k8s.io/exclusive_caas", DeviceIds: []string{"22", "35"}}}}}},
+}
+
+//StartFakePodResourcesServer starts serving the same allocations as the fake checkpoint file on the provided unix socket
+//The Get call of the API is only served when supportsGet is set, like kubelet 1.27 or newer does, otherwise only List is
+func StartFakePodResourcesServer(socket string, supportsGet bool) (*FakePodResourcesServer, error) {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	fakeServer := &FakePodResourcesServer{podResources: fakePodResources, socket: socket}
+	serverOptions := []grpc.ServerOption{}
+	//The vendored API does not know about Get, so its calls reach the handler of unknown methods, which gRPC answers with Unimplemented otherwise
+	if supportsGet {
+		serverOptions = append(serverOptions, grpc.UnknownServiceHandler(fakeServer.handleGet))
+	}
+	fakeServer.grpcServer = grpc.NewServer(serverOptions...)
+	podresourcesapi.RegisterPodResourcesListerServer(fakeServer.grpcServer, fakeServer)
+	go fakeServer.grpcServer.Serve(lis)
+	return fakeServer, nil
+}
+
+func (fakeServer *FakePodResourcesServer) handleGet(srv interface{}, stream grpc.ServerStream) error {
+	if method, _ := grpc.MethodFromServerStream(stream); method != podresources.GetPodResourcesMethod {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	req := &podresources.GetPodResourcesRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	resp, err := fakeServer.Get(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(resp)
+}
+
+//List returns the static allocations of the fake server
+func (fakeServer *FakePodResourcesServer) List(ctx context.Context, req *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	atomic.AddInt32(&fakeServer.listCalls, 1)
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: fakeServer.podResources}, nil
+}
+
+//Get returns the static allocations of one Pod of the fake server, failing for unknown Pods the same way kubelet does
+func (fakeServer *FakePodResourcesServer) Get(ctx context.Context, req *podresources.GetPodResourcesRequest) (*podresources.GetPodResourcesResponse, error) {
+	atomic.AddInt32(&fakeServer.getCalls, 1)
+	for _, podResource := range fakeServer.podResources {
+		if podResource.GetName() == req.PodName && podResource.GetNamespace() == req.PodNamespace {
+			return &podresources.GetPodResourcesResponse{PodResources: podResource}, nil
+		}
+	}
+	return nil, fmt.Errorf("pod %s not found in namespace %s", req.PodName, req.PodNamespace)
+}
+
+//Calls returns how many times the List and the Get calls of the fake server were invoked
+func (fakeServer *FakePodResourcesServer) Calls() (listCalls int, getCalls int) {
+	return int(atomic.LoadInt32(&fakeServer.listCalls)), int(atomic.LoadInt32(&fakeServer.getCalls))
+}
+
+//Stop shuts down the fake server, and removes its socket
+func (fakeServer *FakePodResourcesServer) Stop() {
+	fakeServer.grpcServer.Stop()
+	os.Remove(fakeServer.socket)
+}
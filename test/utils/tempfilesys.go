@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 func check(e error) {
@@ -14,13 +15,17 @@ func check(e error) {
 }
 
 type tmpSysFs struct {
-	dirRoot      string
-	dirList      []string
-	fileList     map[string][]byte
-	originalRoot *os.File
+	dirRoot        string
+	cgroupRoot     string
+	dirList        []string
+	fileList       map[string][]byte
+	parentFileList map[string][]byte
+	rootFileList   map[string][]byte
+	originalRoot   *os.File
 }
 
 var ts = tmpSysFs{
+	cgroupRoot: "/sys/fs/cgroup/cpuset/kubepods",
 	dirList: []string{
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0001/cont01",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0001/infrac1",
@@ -48,51 +53,188 @@ var ts = tmpSysFs{
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0010/cont10",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0010/infrac10",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0011/cont11",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0011/infrac11",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0012/cont12",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0012/infrac12",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0013/cont13",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0013/infrac13",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0014/cont14",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0014/infrac14",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0015/cont15",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0015/infrac15",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0016/cont16",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0016/infrac16",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0017/cont17",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0017/infrac17",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0018/cont18",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0018/infrac18",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0019/cont19",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0019/infrac19",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0021/cont21",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0021/infrac21",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0022/cont22",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0022/infrac22",
 		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0023/cont23",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0023/infrac23",
 	},
 	fileList: map[string][]byte{
 		"cpuset.cpus": []byte("E"),
 	},
 }
 
+//On the unified hierarchy every controller shares the same tree, and the cpuset controller has to be delegated to the leaves via cgroup.subtree_control
+var tsV2 = tmpSysFs{
+	cgroupRoot: "/sys/fs/cgroup/kubepods",
+	dirList: []string{
+		"/sys/fs/cgroup/kubepods/besteffort/pod0001/cont01",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0001/infrac1",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0002/cont02",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0002/infrac2",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0003/cont03a",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0003/cont03b",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0003/infrac3",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0023/cont23",
+		"/sys/fs/cgroup/kubepods/besteffort/pod0023/infrac23",
+	},
+	fileList: map[string][]byte{
+		"cpuset.cpus":           []byte(""),
+		"cpuset.cpus.effective": []byte("0-79"),
+		"cgroup.controllers":    []byte("cpuset cpu io memory pids"),
+	},
+	parentFileList: map[string][]byte{
+		"cpuset.cpus":            []byte(""),
+		"cpuset.cpus.effective":  []byte("0-79"),
+		"cgroup.controllers":     []byte("cpuset cpu io memory pids"),
+		"cgroup.subtree_control": []byte("cpu memory pids"),
+	},
+	rootFileList: map[string][]byte{
+		"cgroup.subtree_control": []byte("cpuset cpu io memory pids"),
+	},
+}
+
+//The systemd cgroup driver nests the Pods into slices, and puts every container into a scope named after the container runtime
+//The dashes of the Pod UIDs are escaped to underscores in the names of the slices
+var tsSystemd = tmpSysFs{
+	cgroupRoot: "/sys/fs/cgroup/cpuset/kubepods.slice",
+	dirList: []string{
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/cri-containerd-cont03a.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/cri-containerd-cont03b.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/cri-containerd-infrac3.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-pod0023_aa.slice/cri-containerd-cont23.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-pod0023_aa.slice/cri-containerd-infrac23.scope",
+	},
+	fileList: map[string][]byte{
+		"cpuset.cpus": []byte(""),
+	},
+}
+
+//CRI-O runs the conmon monitor of every container in its own scope, right next to the scope of the container
+var tsCrio = tmpSysFs{
+	cgroupRoot: "/sys/fs/cgroup/cpuset/kubepods.slice",
+	dirList: []string{
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-cont03a.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-conmon-cont03a.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-cont03b.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-conmon-cont03b.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-infrac3.scope",
+		"/sys/fs/cgroup/cpuset/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0003.slice/crio-conmon-infrac3.scope",
+	},
+	fileList: map[string][]byte{
+		"cpuset.cpus": []byte(""),
+	},
+}
+
+//With the cgroupfs driver CRI-O names the cgroups of the containers, and of their conmon monitors after the container runtime, without any scopes
+var tsCrioCgroupfs = tmpSysFs{
+	cgroupRoot: "/sys/fs/cgroup/cpuset/kubepods",
+	dirList: []string{
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-cont03a",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-conmon-cont03a",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-cont03b",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-conmon-cont03b",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-infrac3",
+		"/sys/fs/cgroup/cpuset/kubepods/besteffort/pod0003/crio-conmon-infrac3",
+	},
+	fileList: map[string][]byte{
+		"cpuset.cpus": []byte(""),
+	},
+}
+
+var activeTs *tmpSysFs
+
 // CreateTempSysFs create temporary fake filesystem for cpusets
 func CreateTempSysFs() (string, error) {
+	return createTempSysFs(&ts)
+}
+
+// CreateTempSysFsV2 create temporary fake filesystem for cpusets on the unified (cgroup v2) hierarchy
+func CreateTempSysFsV2() (string, error) {
+	return createTempSysFs(&tsV2)
+}
+
+// CreateTempSysFsSystemd create temporary fake filesystem for cpusets created by containerd with the systemd cgroup driver
+func CreateTempSysFsSystemd() (string, error) {
+	return createTempSysFs(&tsSystemd)
+}
+
+// CreateTempSysFsCrio create temporary fake filesystem for cpusets created by CRI-O with the systemd cgroup driver
+func CreateTempSysFsCrio() (string, error) {
+	return createTempSysFs(&tsCrio)
+}
+
+// CreateTempSysFsCrioCgroupfs create temporary fake filesystem for cpusets created by CRI-O with the cgroupfs cgroup driver
+func CreateTempSysFsCrioCgroupfs() (string, error) {
+	return createTempSysFs(&tsCrioCgroupfs)
+}
+
+// GetCgroupRoot returns the path of the fake cgroupfs hierarchy root under which Kubernetes creates the cpusets for the Pods
+func GetCgroupRoot() string {
+	if activeTs == nil {
+		return ""
+	}
+	return filepath.Join(activeTs.dirRoot, activeTs.cgroupRoot)
+}
+
+func createTempSysFs(fs *tmpSysFs) (string, error) {
 	originalRoot, err := os.Open("/")
-	ts.originalRoot = originalRoot
+	fs.originalRoot = originalRoot
+	activeTs = fs
 
 	tmpdir, err := ioutil.TempDir("/tmp", "sethandler-")
 	if err != nil {
 		return "", err
 	}
 
-	ts.dirRoot = tmpdir
-	err = exec.Command("sudo", "chmod", "777", ts.dirRoot).Run()
+	fs.dirRoot = tmpdir
+	err = os.Chmod(fs.dirRoot, 0777)
 	if err != nil {
 		return "", err
 	}
 
-	for _, dir := range ts.dirList {
-		if err := os.MkdirAll(filepath.Join(ts.dirRoot, dir), 0777); err != nil {
+	for _, dir := range fs.dirList {
+		if err := os.MkdirAll(filepath.Join(fs.dirRoot, dir), 0777); err != nil {
 			return "", err
 		}
 	}
 
-	for _, dir := range ts.dirList {
-		for filename, content := range ts.fileList {
-			if err := ioutil.WriteFile(filepath.Join(ts.dirRoot, dir, filename), content, 0777); err != nil {
+	for _, dir := range fs.dirList {
+		for filename, content := range fs.fileList {
+			if err := ioutil.WriteFile(filepath.Join(fs.dirRoot, dir, filename), content, 0777); err != nil {
 				return "", err
 			}
 		}
+		for parent := filepath.Dir(dir); len(fs.parentFileList) > 0 && strings.HasPrefix(parent, fs.cgroupRoot); parent = filepath.Dir(parent) {
+			for filename, content := range fs.parentFileList {
+				if err := ioutil.WriteFile(filepath.Join(fs.dirRoot, parent, filename), content, 0777); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	for filename, content := range fs.rootFileList {
+		if err := ioutil.WriteFile(filepath.Join(fs.dirRoot, filepath.Dir(fs.cgroupRoot), filename), content, 0777); err != nil {
+			return "", err
+		}
 	}
 	return tmpdir, nil
 }
@@ -102,7 +244,28 @@ func CreateCheckpointFile() error {
 	var (
 		chkpntPath = "/var/lib/kubelet/device-plugins"
 		fileName   = "kubelet_internal_checkpoint"
-		content    = `{"Data":{"PodDeviceEntries":[
+	)
+	err := exec.Command("sudo", "mkdir", "-p", chkpntPath).Run()
+	if err != nil {
+		return err
+	}
+
+	err = exec.Command("sudo", "touch", chkpntPath+"/"+fileName).Run()
+	if err != nil {
+		return err
+	}
+
+	err = exec.Command("sudo", "chmod", "777", chkpntPath+"/"+fileName).Run()
+	if err != nil {
+		return err
+	}
+	return WriteCheckpointFile(filepath.Join(chkpntPath, fileName))
+}
+
+// WriteCheckpointFile writes the content of the fake checkpoint file to the provided path
+func WriteCheckpointFile(checkpointFile string) error {
+	var (
+		content = `{"Data":{"PodDeviceEntries":[
 			{"PodUID":"pod0002","ContainerName":"cont_exc","ResourceName":"nokia.k8s.io/exclusive_caas","DeviceIDs":{"0":["3","4"]}},
 			{"PodUID":"pod0003","ContainerName":"cont_excl1","ResourceName":"nokia.k8s.io/exclusive_caas","DeviceIDs":{"0":["3","4"]}},
 			{"PodUID":"pod0003","ContainerName":"cont_excl2","ResourceName":"nokia.k8s.io/exclusive_caas","DeviceIDs":{"0":["5","6","7"]}},
@@ -122,39 +285,24 @@ func CreateCheckpointFile() error {
 			"RegisteredDevices":{"nokia.k8s.io/default":["0-2"],"nokia.k8s.io/exclusive_caas":["3","4","5","6","7","8","12","13","14","16","22","35"],"nokia.k8s.io/shared_caas":["5889","74","97","324","383","951"]}},
 			"Checksum":403603645}`
 	)
-	err := exec.Command("sudo", "mkdir", "-p", chkpntPath).Run()
-	if err != nil {
-		return err
-	}
-
-	err = exec.Command("sudo", "touch", chkpntPath+"/"+fileName).Run()
-	if err != nil {
-		return err
-	}
-
-	err = exec.Command("sudo", "chmod", "777", chkpntPath+"/"+fileName).Run()
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(filepath.Join(chkpntPath, fileName), []byte(content), 0777)
-	if err != nil {
-		return err
-	}
-	return nil
+	return ioutil.WriteFile(checkpointFile, []byte(content), 0777)
 }
 
 // RemoveTempSysFs delete temporary fake filesystem
 func RemoveTempSysFs() error {
-	err := ts.originalRoot.Chdir()
+	if activeTs == nil {
+		return nil
+	}
+	err := activeTs.originalRoot.Chdir()
 	if err != nil {
 		return err
 	}
-	if err = ts.originalRoot.Close(); err != nil {
+	if err = activeTs.originalRoot.Close(); err != nil {
 		return err
 	}
-	if err = exec.Command("sudo", "rm", "-rf", ts.dirRoot).Run(); err != nil {
+	if err = os.RemoveAll(activeTs.dirRoot); err != nil {
 		return err
 	}
+	activeTs = nil
 	return nil
 }
@@ -5,14 +5,18 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/nokia/CPU-Pooler/pkg/podresources"
 	"github.com/nokia/CPU-Pooler/pkg/sethandler"
+	"github.com/nokia/CPU-Pooler/pkg/topology"
 	"github.com/nokia/CPU-Pooler/pkg/types"
 	"github.com/nokia/CPU-Pooler/test/utils"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -23,6 +27,7 @@ var (
 	singleThreadPoolConf, _ = types.ReadPoolConfigFile("../../testdata/singleThreadExclusive.yaml")
 	multiThreadPoolConf, _  = types.ReadPoolConfigFile("../../testdata/multiThreadExclusive.yaml")
 	testKubeconfPath        = "../../testdata/testkubeconf.yml"
+	dualSocketHTSysfs, _    = filepath.Abs("../../testdata/sysfs/dual-socket-ht")
 	quantity1, _            = resource.ParseQuantity("1")
 	quantity2, _            = resource.ParseQuantity("2")
 	quantity3, _            = resource.ParseQuantity("3")
@@ -228,58 +233,161 @@ var podAddedTcs = []struct {
 	{"pod_ht_test", false, multiThreadPoolConf, []string{"22,35,62,75"}},
 }
 
+var deviceIDTcs = []struct {
+	podName       string
+	containerName string
+	expectedIDs   []string
+}{
+	{"pod_exc", "cont_exc", []string{"3", "4"}},
+	{"pod_excl_two_container", "cont_excl2", []string{"5", "6", "7"}},
+	{"pod_two_container_sh_exc", "cont_shared", []string{}},
+	{"chckpnt_no_device", "chckpnt_no_device", []string{}},
+	{"chckpnt_no_res", "chckpnt_no_res", []string{}},
+	{"no_chckpnt_entry", "no_chckpnt_entry", []string{}},
+	{"pod_ht_test", "cont_exc_ht", []string{"22", "35"}},
+}
+
 func TestNew(t *testing.T) {
-	sh, err := sethandler.New(testKubeconfPath, testPoolConf1, getFakeCpusetRoot(wildcardFakeCpuSetPath))
+	sh, err := sethandler.New(testKubeconfPath, testPoolConf1, getFakeCpusetRoot(wildcardFakeCpuSetPath), "")
 	if err != nil || sh == nil {
 		t.Errorf("Sethandler object creation failed because: %s", err.Error())
 	}
 }
 
-//TODO: with the change in architecture we now need to stub out k8sclient handler (the fake one provided in the setup was never used internally to begin with)
-//Otherwise this will never work because we now unconditionally re-read the provided Pod at least once
-/*
-func TestPodAdded(t *testing.T) {
-	tempDirPath, err := setupEnv()
+func TestGetContainerDeviceIDsFromPodResources(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "podresources-")
 	if err != nil {
-		t.Errorf("Test suite setup failed: %s", err.Error())
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+	fakeServer, err := utils.StartFakePodResourcesServer(filepath.Join(tempDir, "kubelet.sock"), true)
+	if err != nil {
+		t.Fatalf("Fake PodResources server could not be started: %s", err.Error())
+	}
+	defer fakeServer.Stop()
+	//The checkpoint file must not be touched while the PodResources API is available
+	client := podresources.NewClient(filepath.Join(tempDir, "kubelet.sock"), filepath.Join(tempDir, "non_existing_checkpoint"))
+	for _, tc := range deviceIDTcs {
+		t.Run(tc.podName, func(t *testing.T) {
+			deviceIDs, err := client.GetContainerDeviceIDs(*getPod(tc.podName), tc.containerName, "nokia.k8s.io/exclusive_caas")
+			if err != nil {
+				t.Fatalf("Device IDs could not be read because: %s", err.Error())
+			}
+			if !reflect.DeepEqual(deviceIDs, tc.expectedIDs) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) device IDs", tc.expectedIDs, deviceIDs)
+			}
+		})
 	}
+}
 
-	for _, tc := range podAddedTcs {
+func TestGetContainerDeviceIDsFromCheckpoint(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "podresources-")
+	if err != nil {
+		t.Fatalf("Test suite setup failed: %s", err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+	checkpointFile := filepath.Join(tempDir, "kubelet_internal_checkpoint")
+	if err = utils.WriteCheckpointFile(checkpointFile); err != nil {
+		t.Fatalf("Fake checkpoint file could not be written: %s", err.Error())
+	}
+	client := podresources.NewClient(filepath.Join(tempDir, "missing.sock"), checkpointFile)
+	for _, tc := range deviceIDTcs {
 		t.Run(tc.podName, func(t *testing.T) {
-			testSethandler := setupTestSethandler(tc.poolConf)
-			testSethandler.PodAdded(getPod(tc.podName))
-			cpusActual, err := readFakeCpusetFile(getPod(tc.podName), tempDirPath)
-			if err != nil && !tc.isErrorExpectedAtFakeFileRead {
-				t.Logf("Could not process FAKE cpuset file because: %s", err.Error())
+			deviceIDs, err := client.GetContainerDeviceIDs(*getPod(tc.podName), tc.containerName, "nokia.k8s.io/exclusive_caas")
+			if err != nil {
+				t.Fatalf("Device IDs could not be read because: %s", err.Error())
 			}
-			if !reflect.DeepEqual(cpusActual, tc.expectedCpus) {
-				t.Errorf("Mismatch in expected (%s) vs actual (%s) cpus written in cpuset file: ", tc.expectedCpus, cpusActual)
+			if !reflect.DeepEqual(deviceIDs, tc.expectedIDs) {
+				t.Errorf("Mismatch in expected (%v) vs actual (%v) device IDs", tc.expectedIDs, deviceIDs)
 			}
 		})
 	}
-	err = utils.RemoveTempSysFs()
+}
+
+func TestPodAdded(t *testing.T) {
+	tempDirPath, err := setupEnv()
 	if err != nil {
-		t.Logf("Removal of temp fs for cpusets was unsuccessful due to: %s", err.Error())
+		t.Fatalf("Test suite setup failed: %s", err.Error())
 	}
-}*/
+	defer utils.RemoveTempSysFs()
+	//The topology of the host running the tests must never leak into the provisioned cpusets
+	originalRoot := topology.SysfsRoot
+	topology.SysfsRoot = dualSocketHTSysfs
+	defer func() { topology.SysfsRoot = originalRoot }()
+	//Containers which cannot be provisioned are not retried, the cases expecting untouched cpusets would take long otherwise
+	originalRetryCount := sethandler.MaxRetryCount
+	sethandler.MaxRetryCount = 1
+	defer func() { sethandler.MaxRetryCount = originalRetryCount }()
+	for _, supportsGet := range []bool{true, false} {
+		fakeServer, err := utils.StartFakePodResourcesServer(filepath.Join(tempDirPath, "kubelet.sock"), supportsGet)
+		if err != nil {
+			t.Fatalf("Fake PodResources server could not be started: %s", err.Error())
+		}
+		podResources := podresources.NewClient(filepath.Join(tempDirPath, "kubelet.sock"), filepath.Join(tempDirPath, "non_existing_checkpoint"))
+		for _, tc := range podAddedTcs {
+			t.Run(fmt.Sprintf("%s_get_%t", tc.podName, supportsGet), func(t *testing.T) {
+				resetFakeCpusetFiles(getPod(tc.podName), tempDirPath)
+				testSethandler := setupTestSethandler(tc.poolConf, podResources)
+				pod := runningPod(getPod(tc.podName))
+				testSethandler.PodAdded(pod)
+				testSethandler.ProcessQueuedPods()
+				cpusActual, err := readFakeCpusetFile(pod, tempDirPath)
+				if err != nil && !tc.isErrorExpectedAtFakeFileRead {
+					t.Logf("Could not process FAKE cpuset file because: %s", err.Error())
+				}
+				if !reflect.DeepEqual(cpusActual, tc.expectedCpus) {
+					t.Errorf("Mismatch in expected (%s) vs actual (%s) cpus written in cpuset file: ", tc.expectedCpus, cpusActual)
+				}
+			})
+		}
+		podResources.Close()
+		fakeServer.Stop()
+		_, getCalls := fakeServer.Calls()
+		if supportsGet && getCalls == 0 {
+			t.Errorf("PodResources Get was never called although the server supports it")
+		}
+		if !supportsGet && getCalls != 0 {
+			t.Errorf("PodResources Get was served %d times although the server does not support it", getCalls)
+		}
+	}
+}
 
 func setupEnv() (string, error) {
 	os.Setenv("NODE_NAME", "caas_master")
-	tempDirPath, err := utils.CreateTempSysFs()
-	if err != nil {
-		return "", err
+	//The allocations of the exclusive CPUs are served by the fake PodResources server started in the same directory
+	return utils.CreateTempSysFs()
+}
+
+func setupTestSethandler(poolConf types.PoolConfig, podResources *podresources.Client) *sethandler.SetHandler {
+	sh := &sethandler.SetHandler{}
+	sh.SetSetHandler(poolConf, utils.GetCgroupRoot(), fake.NewSimpleClientset(podsOfNode()...))
+	sh.SetPodResourcesClient(podResources)
+	return sh
+}
+
+//podsOfNode returns the test Pods as the API server would, so the applied cpusets can be published on them
+func podsOfNode() []runtime.Object {
+	var pods []runtime.Object
+	for i := range testPods {
+		pods = append(pods, testPods[i].DeepCopy())
 	}
-	err = utils.CreateCheckpointFile()
-	if err != nil {
-		return "", err
+	return pods
+}
+
+//runningPod returns the Pod with all of its containers reported as running, as only running containers are provisioned
+func runningPod(pod *v1.Pod) *v1.Pod {
+	runningPod := pod.DeepCopy()
+	for i := range runningPod.Status.ContainerStatuses {
+		runningPod.Status.ContainerStatuses[i].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
 	}
-	return tempDirPath, nil
+	return runningPod
 }
 
-func setupTestSethandler(poolConf types.PoolConfig) sethandler.SetHandler {
-	sh := sethandler.SetHandler{}
-	sh.SetSetHandler(poolConf, getFakeCpusetRoot(wildcardFakeCpuSetPath), fake.NewSimpleClientset())
-	return sh
+//resetFakeCpusetFiles restores the initial content of the cpuset files of the Pod, as they are shared by the test cases of the same Pod
+func resetFakeCpusetFiles(pod *v1.Pod, tempDirPath string) {
+	for _, cpusetPath := range podCpuSetPaths[pod.ObjectMeta.Name] {
+		ioutil.WriteFile(filepath.Join(tempDirPath, cpusetPath, "cpuset.cpus"), []byte("E"), 0644)
+	}
 }
 
 func getFakeCpusetRoot(cpusetPath string) string {